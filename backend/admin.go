@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+
+	"portfolio-secrets-service/internal"
+)
+
+// RevokeRequest names the tokens to revoke: a whole token, its ID, or
+// everything issued before a time
+type RevokeRequest struct {
+	Token        string     `json:"token,omitempty"`
+	ID           string     `json:"jti,omitempty"`
+	IssuedBefore *time.Time `json:"issued_before,omitempty"`
+}
+
+// FlushResponse lists the caches that were cleared
+type FlushResponse struct {
+	Flushed []string `json:"flushed"`
+}
+
+// adminRoutes serves the management API on the admin listener. None of
+// these routes are registered on the public router.
+func (s *SecretService) adminRoutes() http.Handler {
+	router := mux.NewRouter()
+	router.NotFoundHandler = internal.NotFoundHandler()
+	router.MethodNotAllowedHandler = internal.MethodNotAllowedHandler()
+
+	router.Use(s.loggingMiddleware)
+	// mTLS comes first so no credential is looked at without a client certificate
+	if s.config.TLS.mutualTLS() {
+		router.Use(internal.RequireClientCert)
+	}
+	router.Use(s.adminAuthMiddleware)
+	router.Use(internal.BodyLimit(s.config.Security.MaxBodyBytes, nil))
+
+	router.Handle("/metrics", s.metrics.Handler()).Methods("GET")
+	router.HandleFunc("/admin/config", s.configDumpHandler).Methods("GET")
+	router.HandleFunc("/admin/usage", s.usage.ReportHandler).Methods("GET")
+	router.HandleFunc("/admin/audit", s.auditQueryHandler).Methods("GET")
+	router.HandleFunc("/admin/cache/flush", s.flushCacheHandler).Methods("POST")
+	router.HandleFunc("/admin/tokens/revoke", s.revokeTokenHandler).Methods("POST")
+	s.registerSecretAdminRoutes(router)
+	s.registerAPIKeyAdminRoutes(router)
+
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	return internal.RequestID(router)
+}
+
+// adminRole lets a session token, such as one issued after OIDC login,
+// use the admin listener
+const adminRole = "admin"
+
+// adminAuthMiddleware requires ADMIN_TOKEN or a session JWT holding the
+// admin role as a bearer token. Visitor JWTs are not accepted.
+func (s *SecretService) adminAuthMiddleware(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.config.Admin.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeAuthRequired, "Authorization header required")
+			return
+		}
+		if s.config.Admin.Token != "" && subtle.ConstantTimeCompare([]byte(header), expected) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if tokenString, ok := strings.CutPrefix(header, "Bearer "); ok {
+			claims, err := s.sessionClaims(tokenString)
+			if err == nil && hasAnyRole(claims.Roles, []string{adminRole}) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+				return
+			}
+		}
+		log.Printf("Admin authentication failed for %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidToken, "Invalid admin token")
+	})
+}
+
+// adminSubject names the operator for audit events: the session user, or
+// "admin" for the shared ADMIN_TOKEN
+func adminSubject(r *http.Request) string {
+	if subject := subjectFromRequest(r); subject != "" {
+		return subject
+	}
+	return "admin"
+}
+
+// configDumpHandler serves the effective configuration with secrets redacted
+func (s *SecretService) configDumpHandler(w http.ResponseWriter, r *http.Request) {
+	out, err := yaml.Marshal(s.config.Redacted())
+	if err != nil {
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to render configuration")
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(out)
+}
+
+// cacheFlushers returns the in-memory caches an operator can clear, by name
+func (s *SecretService) cacheFlushers() map[string]func() {
+	return map[string]func(){
+		"rate_limits":  s.rateLimiter.Reset,
+		"chat_answers": s.chat.Cache.Flush,
+	}
+}
+
+// flushCacheHandler clears the cache named by ?cache=, or all of them
+func (s *SecretService) flushCacheHandler(w http.ResponseWriter, r *http.Request) {
+	flushers := s.cacheFlushers()
+	names := []string{r.URL.Query().Get("cache")}
+	if names[0] == "" {
+		names = names[:0]
+		for name := range flushers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		flush, ok := flushers[name]
+		if !ok {
+			internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "Unknown cache "+name)
+			return
+		}
+		flush()
+		log.Printf("Admin flushed cache %s (request_id=%s)", name, internal.RequestIDFromContext(r.Context()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlushResponse{Flushed: names})
+}
+
+// revokeTokenHandler revokes a visitor token before it expires
+func (s *SecretService) revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req RevokeRequest
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
+		internal.WriteDecodeError(w, r, err)
+		return
+	}
+
+	switch {
+	case req.Token != "":
+		claims := &Claims{}
+		// An expired token needs no revocation, so only valid ones are accepted
+		if _, err := jwt.ParseWithClaims(req.Token, claims, s.jwtKey); err != nil {
+			internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "Token is not a valid, unexpired token")
+			return
+		}
+		if claims.ID == "" {
+			internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "Token has no ID; revoke by issued_before instead")
+			return
+		}
+		// Without exp a token lives no longer than any token we issue
+		expires := time.Now().Add(tokenLifetime)
+		if claims.ExpiresAt != nil {
+			expires = claims.ExpiresAt.Time
+		}
+		s.revocations.Revoke(claims.ID, expires)
+		log.Printf("Admin revoked token %s for %s", claims.ID, claims.Username)
+	case req.ID != "":
+		s.revocations.Revoke(req.ID, time.Now().Add(tokenLifetime))
+		log.Printf("Admin revoked token %s", req.ID)
+	case req.IssuedBefore != nil:
+		s.revocations.RevokeIssuedBefore(*req.IssuedBefore)
+		log.Printf("Admin revoked all tokens issued before %s", req.IssuedBefore.Format(time.RFC3339))
+	default:
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "One of token, jti or issued_before is required")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"portfolio-secrets-service/internal"
+)
+
+func TestAdminListener(t *testing.T) {
+	service := newContractTestService(t, "sk-test")
+	service.config.Admin.Token = "admin-test-token"
+	public := service.routes()
+	admin := service.adminRoutes()
+
+	login := func() string {
+		req := httptest.NewRequest("POST", "/auth", strings.NewReader(`{"username":"testuser","password":"testpass"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		public.ServeHTTP(rr, req)
+		var auth AuthResponse
+		json.Unmarshal(rr.Body.Bytes(), &auth)
+		return auth.Token
+	}
+	send := func(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	visitorToken := login()
+
+	t.Run("auth", func(t *testing.T) {
+		for _, token := range []string{"", "wrong", visitorToken} {
+			if rr := send(admin, "GET", "/metrics", token, ""); rr.Code != http.StatusUnauthorized {
+				t.Errorf("token %q: status = %d, want 401", token, rr.Code)
+			}
+		}
+		if rr := send(admin, "GET", "/metrics", "admin-test-token", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "http_requests_total") {
+			t.Errorf("metrics: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := send(admin, "GET", "/debug/pprof/", "admin-test-token", ""); rr.Code != http.StatusOK {
+			t.Errorf("pprof index: status = %d", rr.Code)
+		}
+	})
+
+	t.Run("usage report", func(t *testing.T) {
+		rr := send(admin, "GET", "/admin/usage", "admin-test-token", "")
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"last_30_days"`) {
+			t.Errorf("usage: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := send(admin, "GET", "/admin/usage", visitorToken, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("usage with a visitor token: status = %d, want 401", rr.Code)
+		}
+	})
+
+	t.Run("not on the public router", func(t *testing.T) {
+		for _, path := range []string{"/metrics", "/admin/config", "/api/v1/admin/usage", "/api/admin/usage", "/debug/pprof/"} {
+			if rr := send(public, "GET", path, visitorToken, ""); rr.Code != http.StatusNotFound {
+				t.Errorf("%s on public router: status = %d, want 404", path, rr.Code)
+			}
+		}
+	})
+
+	t.Run("config dump is redacted", func(t *testing.T) {
+		rr := send(admin, "GET", "/admin/config", "admin-test-token", "")
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), redactedValue) {
+			t.Fatalf("status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		for _, secret := range []string{"contract-test-secret", "testpass", "admin-test-token"} {
+			if strings.Contains(rr.Body.String(), secret) {
+				t.Errorf("config dump leaks %q", secret)
+			}
+		}
+	})
+
+	t.Run("cache flush", func(t *testing.T) {
+		rr := send(admin, "POST", "/admin/cache/flush", "admin-test-token", "")
+		var flushed FlushResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &flushed); err != nil || len(flushed.Flushed) == 0 {
+			t.Errorf("flush all: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := send(admin, "POST", "/admin/cache/flush?cache=nope", "admin-test-token", ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("unknown cache: status = %d, want 400", rr.Code)
+		}
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		send(public, "GET", "/api/v1/secrets/firebase", visitorToken, "")
+		send(public, "GET", "/api/v1/secrets/database", visitorToken, "")
+		send(public, "POST", "/auth", "", `{"username":"testuser","password":"wrong"}`)
+
+		rr := send(admin, "GET", "/admin/audit?action=secret.read", "admin-test-token", "")
+		var result AuditQueryResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || len(result.Events) != 2 {
+			t.Fatalf("status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		read, denied := result.Events[0], result.Events[1]
+		if read.Secret != "firebase" || read.Outcome != "success" || read.Subject != "testuser" || read.IP == "" || read.RequestID == "" {
+			t.Errorf("unexpected secret read event: %+v", read)
+		}
+		if denied.Secret != "database" || denied.Outcome != "denied" {
+			t.Errorf("unexpected denied event: %+v", denied)
+		}
+
+		rr = send(admin, "GET", "/admin/audit?action=auth.attempt&outcome=failure&limit=1", "admin-test-token", "")
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		if len(result.Events) != 1 || result.Events[0].Subject != "testuser" || result.Events[0].Reason != "invalid credentials" {
+			t.Errorf("unexpected auth failure events: %s", rr.Body.String())
+		}
+
+		rr = send(admin, "GET", "/admin/audit?action=token.issue", "admin-test-token", "")
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		if len(result.Events) == 0 || result.Events[0].TokenID == "" {
+			t.Errorf("expected token issuance events with IDs, got %s", rr.Body.String())
+		}
+
+		if rr := send(admin, "GET", "/admin/audit?since=yesterday", "admin-test-token", ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("bad since: status = %d, want 400", rr.Code)
+		}
+	})
+
+	t.Run("secret management", func(t *testing.T) {
+		readPublic := func() string {
+			var secret SecretResponse
+			json.Unmarshal(send(public, "GET", "/api/v1/secrets/firebase", visitorToken, "").Body.Bytes(), &secret)
+			return secret.Secret
+		}
+		envValue := readPublic()
+
+		rr := send(admin, "POST", "/admin/secrets", "admin-test-token", `{"name":"firebase","value":"fb-v1"}`)
+		var metadata SecretMetadata
+		if err := json.Unmarshal(rr.Body.Bytes(), &metadata); err != nil || rr.Code != http.StatusCreated || metadata.Version != 1 || metadata.Backend != "file" {
+			t.Fatalf("create: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "fb-v1") {
+			t.Errorf("create response leaks the value: %s", rr.Body.String())
+		}
+		if got := readPublic(); got != "fb-v1" {
+			t.Errorf("public read after create = %q, want the stored value", got)
+		}
+		if rr := send(admin, "POST", "/admin/secrets", "admin-test-token", `{"name":"firebase","value":"again"}`); rr.Code != http.StatusConflict {
+			t.Errorf("duplicate create: status = %d, want 409", rr.Code)
+		}
+
+		if rr := send(admin, "PUT", "/admin/secrets/firebase", "admin-test-token", `{"value":"fb-v2","expected_version":1}`); rr.Code != http.StatusOK {
+			t.Fatalf("update: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		rr = send(admin, "PUT", "/admin/secrets/firebase", "admin-test-token", `{"value":"stale","expected_version":1}`)
+		if rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), "version_conflict") {
+			t.Errorf("stale update: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+
+		rr = send(admin, "POST", "/admin/secrets/firebase/rotate", "admin-test-token", `{"expected_version":2}`)
+		metadata = SecretMetadata{}
+		json.Unmarshal(rr.Body.Bytes(), &metadata)
+		if rr.Code != http.StatusOK || metadata.Version != 3 || metadata.Value == "" || len(metadata.Versions) != 3 {
+			t.Fatalf("rotate: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if got := readPublic(); got != metadata.Value {
+			t.Errorf("public read after rotate = %q, want the generated value", got)
+		}
+
+		if rr := send(admin, "POST", "/admin/secrets/firebase/rollback", "admin-test-token", `{"version":2,"expected_version":3}`); rr.Code != http.StatusOK {
+			t.Fatalf("rollback: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if got := readPublic(); got != "fb-v2" {
+			t.Errorf("public read after rollback = %q, want fb-v2", got)
+		}
+		if rr := send(admin, "POST", "/admin/secrets/firebase/rollback", "admin-test-token", `{"version":99,"expected_version":4}`); rr.Code != http.StatusNotFound {
+			t.Errorf("rollback to unknown version: status = %d, want 404", rr.Code)
+		}
+
+		if rr := send(admin, "DELETE", "/admin/secrets/firebase?expected_version=3", "admin-test-token", ""); rr.Code != http.StatusConflict {
+			t.Errorf("stale delete: status = %d, want 409", rr.Code)
+		}
+		if rr := send(admin, "DELETE", "/admin/secrets/firebase?expected_version=4", "admin-test-token", ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("delete: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if got := readPublic(); got != envValue {
+			t.Errorf("public read after delete = %q, want the environment value again", got)
+		}
+
+		rr = send(admin, "GET", "/admin/audit?secret=firebase&outcome=success", "admin-test-token", "")
+		var result AuditQueryResponse
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		var actions []string
+		for _, event := range result.Events {
+			if strings.HasPrefix(event.Action, "secret.") && event.Action != "secret.read" {
+				actions = append(actions, event.Action)
+			}
+		}
+		if got := strings.Join(actions, ","); got != "secret.create,secret.update,secret.rotate,secret.rollback,secret.delete" {
+			t.Errorf("audited admin actions = %s", got)
+		}
+
+		// Only in the environment again: the version shown there is the one to write against
+		metadata = SecretMetadata{}
+		json.Unmarshal(send(admin, "GET", "/admin/secrets/firebase", "admin-test-token", "").Body.Bytes(), &metadata)
+		if metadata.Backend != "env" {
+			t.Fatalf("metadata after delete = %+v", metadata)
+		}
+		rr = send(admin, "PUT", "/admin/secrets/firebase", "admin-test-token", fmt.Sprintf(`{"value":"fb-v5","expected_version":%d}`, metadata.Version))
+		metadata = SecretMetadata{}
+		json.Unmarshal(rr.Body.Bytes(), &metadata)
+		if rr.Code != http.StatusOK || metadata.Backend != "file" || metadata.Version != 5 {
+			t.Errorf("update of an environment secret: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		send(admin, "DELETE", "/admin/secrets/firebase?expected_version=5", "admin-test-token", "")
+	})
+
+	t.Run("secret reload", func(t *testing.T) {
+		// Another process edits the secrets file
+		other, err := internal.NewFileSecretStore(service.config.Secrets.File, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.Put("firebase", "fb-external", 0); err != nil {
+			t.Fatal(err)
+		}
+
+		rr := send(admin, "POST", "/admin/secrets/reload", "admin-test-token", "")
+		var reload SecretReloadResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &reload); err != nil || strings.Join(reload.Changed, ",") != "firebase" {
+			t.Fatalf("reload: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		var secret SecretResponse
+		json.Unmarshal(send(public, "GET", "/api/v1/secrets/firebase", visitorToken, "").Body.Bytes(), &secret)
+		if secret.Secret != "fb-external" {
+			t.Errorf("public read after reload = %q", secret.Secret)
+		}
+		if got := service.metrics.Value("secret_changes_total", "secret", "firebase"); got != 1 {
+			t.Errorf("secret_changes_total = %v, want 1", got)
+		}
+
+		rr = send(admin, "POST", "/admin/secrets/reload", "admin-test-token", "")
+		if !strings.Contains(rr.Body.String(), `"changed":[]`) {
+			t.Errorf("second reload should find no changes, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		rr := send(admin, "POST", "/admin/apikeys", "admin-test-token", `{"name":"deploy-check","scopes":["operator"],"expires_in_days":30}`)
+		var minted APIKeyResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &minted); err != nil || rr.Code != http.StatusCreated || minted.Key == "" || minted.ExpiresAt == nil {
+			t.Fatalf("mint: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+
+		withKey := func(path string, header, value string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set(header, value)
+			rr := httptest.NewRecorder()
+			public.ServeHTTP(rr, req)
+			return rr
+		}
+		if rr := withKey("/api/v1/secrets", "X-API-Key", minted.Key); rr.Code != http.StatusOK {
+			t.Errorf("X-API-Key with operator scope: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := withKey("/api/v1/secrets/openai", "Authorization", "ApiKey "+minted.Key); rr.Code != http.StatusOK {
+			t.Errorf("Authorization: ApiKey: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := withKey("/api/v1/secrets/openai", "X-API-Key", minted.Key+"x"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("wrong key: status = %d, want 401", rr.Code)
+		}
+
+		rr = send(admin, "GET", "/admin/apikeys", "admin-test-token", "")
+		var list APIKeyListResponse
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		if len(list.Keys) != 1 || list.Keys[0].Prefix != minted.Prefix || list.Keys[0].LastUsedAt == nil || list.Keys[0].Key != "" {
+			t.Errorf("list: %s", rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "hash") {
+			t.Errorf("list exposes key hashes: %s", rr.Body.String())
+		}
+
+		if rr := send(admin, "DELETE", "/admin/apikeys/"+minted.ID, "admin-test-token", ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("revoke: status = %d", rr.Code)
+		}
+		if rr := withKey("/api/v1/secrets/openai", "X-API-Key", minted.Key); rr.Code != http.StatusUnauthorized {
+			t.Errorf("revoked key: status = %d, want 401", rr.Code)
+		}
+
+		rr = send(admin, "GET", "/admin/audit?subject=apikey:deploy-check&action=auth.attempt", "admin-test-token", "")
+		var result AuditQueryResponse
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		if len(result.Events) != 1 || result.Events[0].Reason != "API key revoked" {
+			t.Errorf("expected the revoked key's attempt in the audit log, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("token revocation", func(t *testing.T) {
+		token := login()
+		if rr := send(public, "GET", "/api/v1/secrets/openai", token, ""); rr.Code != http.StatusOK {
+			t.Fatalf("before revocation: status = %d", rr.Code)
+		}
+		if rr := send(admin, "POST", "/admin/tokens/revoke", "admin-test-token", `{"token":"`+token+`"}`); rr.Code != http.StatusNoContent {
+			t.Fatalf("revoke: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := send(public, "GET", "/api/v1/secrets/openai", token, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("revoked token: status = %d, want 401", rr.Code)
+		}
+		if rr := send(public, "GET", "/api/v1/secrets/openai", visitorToken, ""); rr.Code != http.StatusOK {
+			t.Errorf("other tokens should still work, got %d", rr.Code)
+		}
+
+		cutoff := time.Now().Add(time.Second).Format(time.RFC3339)
+		if rr := send(admin, "POST", "/admin/tokens/revoke", "admin-test-token", `{"issued_before":"`+cutoff+`"}`); rr.Code != http.StatusNoContent {
+			t.Fatalf("revoke all: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+		if rr := send(public, "GET", "/api/v1/secrets/openai", visitorToken, ""); rr.Code != http.StatusUnauthorized {
+			t.Errorf("token issued before cutoff: status = %d, want 401", rr.Code)
+		}
+
+		if rr := send(admin, "POST", "/admin/tokens/revoke", "admin-test-token", `{}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("empty revoke request: status = %d, want 400", rr.Code)
+		}
+
+		noExpiry, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			Username:         "testuser",
+			RegisteredClaims: jwt.RegisteredClaims{ID: "no-exp", IssuedAt: jwt.NewNumericDate(time.Now())},
+		}).SignedString([]byte(service.config.JWTSecret))
+		if rr := send(admin, "POST", "/admin/tokens/revoke", "admin-test-token", `{"token":"`+noExpiry+`"}`); rr.Code != http.StatusNoContent {
+			t.Errorf("revoke token without exp: status = %d, body %q", rr.Code, rr.Body.String())
+		}
+	})
+}
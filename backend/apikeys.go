@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"portfolio-secrets-service/internal"
+)
+
+// MintAPIKeyRequest creates an API key. Scopes act as the key's roles for
+// secret policies and metadata access. ExpiresInDays defaults to
+// api_keys.default_ttl_days; 0 never expires.
+type MintAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days,omitempty"`
+}
+
+// APIKeyResponse describes a key without its hash. Key is only set when minting.
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Prefix     string     `json:"prefix"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// APIKeyListResponse lists every key, including revoked ones
+type APIKeyListResponse struct {
+	Keys []APIKeyResponse `json:"keys"`
+}
+
+func apiKeyResponse(key internal.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Prefix:     key.Prefix(),
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+// registerAPIKeyAdminRoutes adds API key management to the admin router
+func (s *SecretService) registerAPIKeyAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/apikeys", s.mintAPIKeyHandler).Methods("POST")
+	router.HandleFunc("/admin/apikeys", s.listAPIKeysHandler).Methods("GET")
+	router.HandleFunc("/admin/apikeys/{id}", s.revokeAPIKeyHandler).Methods("DELETE")
+}
+
+func (s *SecretService) mintAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req MintAPIKeyRequest
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
+		internal.WriteDecodeError(w, r, err)
+		return
+	}
+	if req.Name == "" || len(req.Name) > 64 {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "name is required (up to 64 characters)")
+		return
+	}
+	for _, scope := range req.Scopes {
+		if scope == "" || strings.ContainsAny(scope, ", ") {
+			internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "scopes must be non-empty words")
+			return
+		}
+	}
+	days := s.config.APIKeys.DefaultTTLDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	if days < 0 {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "expires_in_days must not be negative")
+		return
+	}
+	var expiresAt time.Time
+	if days > 0 {
+		expiresAt = time.Now().AddDate(0, 0, days)
+	}
+
+	key, plaintext, err := s.apiKeys.Mint(req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		log.Printf("Failed to mint API key: %v", err)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAPIKeyMint, Outcome: internal.AuditError, Subject: adminSubject(r), Reason: err.Error()})
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to mint API key")
+		return
+	}
+	log.Printf("Admin minted API key %s (%s) with scopes %v", key.Prefix(), key.Name, key.Scopes)
+	s.audit(r, internal.AuditEvent{Action: internal.AuditAPIKeyMint, Outcome: internal.AuditSuccess, Subject: adminSubject(r), TokenID: key.ID, Reason: key.Name})
+
+	response := apiKeyResponse(key)
+	response.Key = plaintext
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *SecretService) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	response := APIKeyListResponse{Keys: []APIKeyResponse{}}
+	for _, key := range s.apiKeys.List() {
+		response.Keys = append(response.Keys, apiKeyResponse(key))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *SecretService) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	key, err := s.apiKeys.Revoke(id)
+	if errors.Is(err, internal.ErrAPIKeyInvalid) {
+		internal.WriteError(w, r, http.StatusNotFound, internal.CodeNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke API key %s: %v", id, err)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAPIKeyRevoke, Outcome: internal.AuditError, Subject: adminSubject(r), TokenID: id, Reason: err.Error()})
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to revoke API key")
+		return
+	}
+	log.Printf("Admin revoked API key %s (%s)", key.Prefix(), key.Name)
+	s.audit(r, internal.AuditEvent{Action: internal.AuditAPIKeyRevoke, Outcome: internal.AuditSuccess, Subject: adminSubject(r), TokenID: key.ID, Reason: key.Name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiKeyFromRequest returns a key sent as "Authorization: ApiKey <key>" or X-API-Key
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// apiKeyClaims authenticates an API key as claims for the key's name and scopes
+func (s *SecretService) apiKeyClaims(r *http.Request, plaintext string) (*Claims, error) {
+	key, err := s.apiKeys.Verify(plaintext)
+	if err != nil {
+		subject := ""
+		if key.ID != "" {
+			subject = apiKeySubject(key)
+		}
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Subject: subject, TokenID: key.ID, Reason: err.Error()})
+		return nil, err
+	}
+	return &Claims{
+		Username:         apiKeySubject(key),
+		Roles:            key.Scopes,
+		RegisteredClaims: jwt.RegisteredClaims{ID: key.ID},
+	}, nil
+}
+
+func apiKeySubject(key internal.APIKey) string {
+	return "apikey:" + key.Name
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"portfolio-secrets-service/internal"
+)
+
+const (
+	defaultAuditQueryLimit = 100
+	maxAuditQueryLimit     = 1000
+)
+
+// AuditQueryResponse is returned by the admin audit endpoint
+type AuditQueryResponse struct {
+	Events []internal.AuditEvent `json:"events"`
+}
+
+// auditQueryHandler lists audit events filtered by action, outcome, subject,
+// secret, since/until (RFC 3339) and limit (most recent first N)
+func (s *SecretService) auditQueryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := internal.AuditFilter{
+		Action:  query.Get("action"),
+		Outcome: query.Get("outcome"),
+		Subject: query.Get("subject"),
+		Secret:  query.Get("secret"),
+		Limit:   defaultAuditQueryLimit,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxAuditQueryLimit {
+			internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditQueryLimit))
+			return
+		}
+		filter.Limit = n
+	}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	events, err := s.auditLog.Query(filter)
+	if err != nil {
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to read audit log")
+		return
+	}
+	if events == nil {
+		events = []internal.AuditEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditQueryResponse{Events: events})
+}
+
+// runAuditCommand implements `audit verify`, which checks the hash chain
+func runAuditCommand(args []string) int {
+	usage := "usage: secrets-service audit verify [--config file] [--file audit.log]"
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	configPath := flags.String("config", "", "path to the YAML config file")
+	file := flags.String("file", "", "audit log to verify (defaults to audit.file from the config)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	path := *file
+	if path == "" {
+		config, err := loadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			return 1
+		}
+		path = config.Audit.File
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "no audit log configured")
+		return 1
+	}
+
+	result, err := internal.VerifyAuditLog(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit log %s failed verification after %d good entries: %v\n", path, result.Events, err)
+		return 1
+	}
+	fmt.Printf("audit log %s is intact: %d entries, head hash %s\n", path, result.Events, result.HeadHash)
+	return 0
+}
@@ -0,0 +1,891 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+
+	"portfolio-secrets-service/internal"
+)
+
+const (
+	defaultJWTSecret    = "your-jwt-secret-change-this"
+	defaultAuthPassword = "changeme"
+	defaultConfigFile   = "config.yaml"
+	redactedValue       = "[REDACTED]"
+)
+
+// Config holds all configuration. Values come from defaults, then the YAML
+// config file, then environment variables (named by the env tag).
+// Fields tagged secret:"true" are redacted by `config print --redacted`.
+type Config struct {
+	Environment  string `yaml:"environment" env:"APP_ENV"`
+	Port         string `yaml:"port" env:"PORT"`
+	JWTSecret    string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	AuthUsername string `yaml:"auth_username" env:"VITE_SECRETS_SERVICE_USERNAME"`
+	AuthPassword string `yaml:"auth_password" env:"VITE_SECRETS_SERVICE_PASSWORD" secret:"true"`
+	// AuthRoles are put in tokens issued by /auth and matched by secret policies
+	AuthRoles   []string `yaml:"auth_roles" env:"AUTH_ROLES"`
+	OpenAIKey   string   `yaml:"openai_api_key" env:"OPENAI_API_KEY" secret:"true"`
+	FirebaseKey string   `yaml:"firebase_api_key" env:"FIREBASE_API_KEY" secret:"true"`
+	// Add more API keys as needed
+
+	// TrustProxyHeaders uses X-Forwarded-For for the client IP (behind Traefik)
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers" env:"TRUST_PROXY_HEADERS"`
+
+	API      APIConfig        `yaml:"api"`
+	Admin    AdminConfig      `yaml:"admin"`
+	Audit    AuditConfig      `yaml:"audit"`
+	Secrets  SecretsConfig    `yaml:"secrets"`
+	APIKeys  APIKeysConfig    `yaml:"api_keys"`
+	OIDC     OIDCConfig       `yaml:"oidc"`
+	Session  SessionConfig    `yaml:"session"`
+	TLS      TLSConfig        `yaml:"tls"`
+	CORS     CORSConfig       `yaml:"cors"`
+	Security SecurityConfig   `yaml:"security"`
+	Chat     ChatLimitsConfig `yaml:"chat"`
+}
+
+// APIConfig controls API versioning. Routes live under /api/v1; the
+// unversioned /api aliases stay available, marked deprecated, until the sunset date.
+type APIConfig struct {
+	LegacyRoutes          bool   `yaml:"legacy_routes" env:"API_LEGACY_ROUTES"`
+	LegacyDeprecatedSince string `yaml:"legacy_deprecated_since"`               // YYYY-MM-DD
+	LegacySunset          string `yaml:"legacy_sunset" env:"API_LEGACY_SUNSET"` // YYYY-MM-DD, empty if not scheduled
+}
+
+// AdminConfig is the management listener for metrics, pprof and operator
+// actions. It is kept off the public port; bind it to localhost or a
+// private network only.
+type AdminConfig struct {
+	Addr string `yaml:"addr" env:"ADMIN_ADDR"` // empty disables the listener
+	// Token is a shared bearer token; OIDC sessions with the admin role work too
+	Token string `yaml:"token" env:"ADMIN_TOKEN" secret:"true"`
+}
+
+// Enabled reports whether the admin listener should start
+func (a AdminConfig) Enabled() bool {
+	return a.Addr != ""
+}
+
+// AuditConfig controls the hash-chained audit log of logins, token
+// issuance and secret reads
+type AuditConfig struct {
+	File string `yaml:"file" env:"AUDIT_LOG_FILE"` // empty disables auditing
+}
+
+// SecretsConfig controls the writable secret store managed through the
+// admin API. Secrets there shadow the same names from the environment.
+type SecretsConfig struct {
+	File         string `yaml:"file" env:"SECRETS_FILE"` // empty keeps secrets read-only from the environment
+	KeepVersions int    `yaml:"keep_versions" env:"SECRETS_KEEP_VERSIONS"`
+	// ReloadIntervalSeconds is how often the secrets file, .env and config
+	// file are checked for changes; SIGHUP triggers a check immediately
+	ReloadIntervalSeconds int `yaml:"reload_interval_seconds" env:"SECRETS_RELOAD_INTERVAL_SECONDS"`
+	// Policies say who may read which secret on the public API. Secrets
+	// without a policy are not readable; empty uses the openai and firebase defaults.
+	Policies map[string]internal.SecretPolicy `yaml:"policies"`
+	// MetadataRoles may list every secret's metadata on GET /api/v1/secrets
+	MetadataRoles []string `yaml:"metadata_roles" env:"SECRETS_METADATA_ROLES"`
+}
+
+func (s SecretsConfig) policies() map[string]internal.SecretPolicy {
+	if len(s.Policies) == 0 {
+		return internal.DefaultSecretPolicies
+	}
+	return s.Policies
+}
+
+// APIKeysConfig stores the hashed API keys minted on the admin listener
+type APIKeysConfig struct {
+	File string `yaml:"file" env:"API_KEYS_FILE"` // empty keeps keys in memory until restart
+	// DefaultTTLDays is the lifetime of keys minted without expires_in_days; 0 never expires
+	DefaultTTLDays int `yaml:"default_ttl_days" env:"API_KEYS_DEFAULT_TTL_DAYS"`
+}
+
+// OIDCConfig enables operator sign-in through an OpenID Connect issuer.
+// Allowed users get our own session token carrying the mapped roles; the
+// "admin" role is also accepted by the admin listener.
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer" env:"OIDC_ISSUER"` // empty disables OIDC login
+	ClientID     string   `yaml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"` // https://<host>/auth/oidc/callback
+	Scopes       []string `yaml:"scopes" env:"OIDC_SCOPES"`
+	// AllowedEmails and AllowedDomains name who may sign in; at least one is required
+	AllowedEmails  []string `yaml:"allowed_emails" env:"OIDC_ALLOWED_EMAILS"`
+	AllowedDomains []string `yaml:"allowed_domains" env:"OIDC_ALLOWED_DOMAINS"`
+	// Roles are given to every allowed user; values of RoleClaim add the roles in RoleMapping
+	Roles       []string            `yaml:"roles" env:"OIDC_ROLES"`
+	RoleClaim   string              `yaml:"role_claim" env:"OIDC_ROLE_CLAIM"`
+	RoleMapping map[string][]string `yaml:"role_mapping"`
+	// PostLoginRedirect receives the session token in the URL fragment; empty returns it as JSON
+	PostLoginRedirect string `yaml:"post_login_redirect" env:"OIDC_POST_LOGIN_REDIRECT"`
+}
+
+// Enabled reports whether the OIDC login routes are served
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+func (o OIDCConfig) validate(production bool) []error {
+	if !o.Enabled() {
+		return nil
+	}
+	var errs []error
+	if o.ClientID == "" {
+		errs = append(errs, errors.New("oidc.client_id is required when oidc.issuer is set"))
+	}
+	if u, err := url.Parse(o.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("oidc.redirect_url must be an absolute URL, got %q", o.RedirectURL))
+	}
+	if len(o.AllowedEmails) == 0 && len(o.AllowedDomains) == 0 {
+		errs = append(errs, errors.New("oidc.allowed_emails or oidc.allowed_domains is required; refusing to let any account sign in"))
+	}
+	if production && !strings.HasPrefix(o.Issuer, "https://") {
+		errs = append(errs, errors.New("oidc.issuer must use https in production"))
+	}
+	return errs
+}
+
+// SessionConfig controls how browsers hold the session JWT. With Cookies on,
+// sign-in sets an HttpOnly session cookie plus a CSRF cookie instead of
+// returning the token, so page scripts never see it. Bearer tokens keep working.
+type SessionConfig struct {
+	Cookies    bool   `yaml:"cookies" env:"SESSION_COOKIES"`
+	CookieName string `yaml:"cookie_name" env:"SESSION_COOKIE_NAME"`
+	Domain     string `yaml:"domain" env:"SESSION_COOKIE_DOMAIN"` // empty is host-only
+	Path       string `yaml:"path" env:"SESSION_COOKIE_PATH"`
+	Secure     bool   `yaml:"secure" env:"SESSION_COOKIE_SECURE"`
+	SameSite   string `yaml:"same_site" env:"SESSION_COOKIE_SAMESITE"` // strict, lax or none
+	// Cookie sessions must echo the CSRF cookie in CSRFHeader on POST, PUT, PATCH and DELETE
+	CSRFCookieName string `yaml:"csrf_cookie_name" env:"SESSION_CSRF_COOKIE_NAME"`
+	CSRFHeader     string `yaml:"csrf_header" env:"SESSION_CSRF_HEADER"`
+}
+
+func (s SessionConfig) validate(production bool) []error {
+	if !s.Cookies {
+		return nil
+	}
+	var errs []error
+	switch s.SameSite {
+	case "strict", "lax":
+	case "none":
+		if !s.Secure {
+			errs = append(errs, errors.New("session.same_site none requires session.secure"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("session.same_site must be strict, lax or none, got %q", s.SameSite))
+	}
+	if s.CookieName == "" || s.CSRFCookieName == "" || s.CSRFHeader == "" {
+		errs = append(errs, errors.New("session.cookie_name, session.csrf_cookie_name and session.csrf_header are required with session.cookies"))
+	}
+	if !strings.HasPrefix(s.Path, "/") {
+		errs = append(errs, errors.New("session.path must start with /"))
+	}
+	if production && !s.Secure {
+		errs = append(errs, errors.New("session.secure must be on in production"))
+	}
+	return errs
+}
+
+// TLSConfig enables in-process TLS for self-hosted deployments. Leave it
+// disabled behind Traefik or Lightsail, which terminate TLS themselves.
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled" env:"TLS_ENABLED"`
+	CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"TLS_KEY_FILE"`
+	// ReloadIntervalSeconds is how often the cert/key files are checked for changes
+	ReloadIntervalSeconds int      `yaml:"reload_interval_seconds" env:"TLS_RELOAD_INTERVAL_SECONDS"`
+	MinVersion            string   `yaml:"min_version" env:"TLS_MIN_VERSION"`     // 1.2 or 1.3
+	CipherSuites          []string `yaml:"cipher_suites" env:"TLS_CIPHER_SUITES"` // TLS 1.2 only, empty uses Go's defaults
+	// RedirectPort serves plain HTTP redirects to HTTPS; empty disables the listener
+	RedirectPort string `yaml:"redirect_port" env:"TLS_REDIRECT_PORT"`
+	// ClientCAFile turns on mTLS for the admin listener: it requires a
+	// client certificate signed by one of these CAs
+	ClientCAFile string `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+}
+
+// SecurityConfig controls response hardening headers and request body limits
+type SecurityConfig struct {
+	HSTSMaxAgeSeconds     int    `yaml:"hsts_max_age_seconds" env:"HSTS_MAX_AGE_SECONDS"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY"`
+	MaxBodyBytes          int64  `yaml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+	// RouteBodyLimits overrides MaxBodyBytes for exact request paths
+	RouteBodyLimits map[string]int64 `yaml:"route_body_limits"`
+}
+
+// CORSConfig is the default CORS policy plus optional per-route overrides
+type CORSConfig struct {
+	// AllowedOrigins apply in every environment. Patterns may contain one
+	// wildcard, e.g. https://*.ethanmerrill.com.
+	AllowedOrigins []string `yaml:"allowed_origins" env:"ALLOWED_ORIGINS"`
+	// EnvironmentOrigins are added only when running in that environment
+	EnvironmentOrigins map[string][]string `yaml:"environment_origins"`
+	AllowedHeaders     []string            `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders     []string            `yaml:"exposed_headers"`
+	AllowCredentials   bool                `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAgeSeconds      int                 `yaml:"max_age_seconds" env:"CORS_MAX_AGE_SECONDS"`
+	Routes             []CORSRoutePolicy   `yaml:"routes"`
+}
+
+// CORSRoutePolicy overrides the default policy for paths under PathPrefix.
+// Empty lists inherit the default policy's values.
+type CORSRoutePolicy struct {
+	PathPrefix       string   `yaml:"path_prefix"`
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAgeSeconds    int      `yaml:"max_age_seconds"`
+}
+
+// ChatLimitsConfig holds the rate limits and spend caps for /api/chat
+type ChatLimitsConfig struct {
+	RateLimitPerMinute int                  `yaml:"rate_limit_per_minute" env:"CHAT_RATE_LIMIT_PER_MINUTE"`
+	RateLimitBurst     int                  `yaml:"rate_limit_burst" env:"CHAT_RATE_LIMIT_BURST"`
+	DailyQuota         int                  `yaml:"daily_quota" env:"CHAT_DAILY_QUOTA"`
+	DailyBudgetUSD     float64              `yaml:"daily_budget_usd" env:"CHAT_DAILY_BUDGET_USD"`
+	MonthlyBudgetUSD   float64              `yaml:"monthly_budget_usd" env:"CHAT_MONTHLY_BUDGET_USD"`
+	UsageFile          string               `yaml:"usage_file" env:"USAGE_FILE"`
+	ModelPrices        internal.ModelPrices `yaml:"model_prices" env:"OPENAI_MODEL_PRICES"`
+	// Repeated questions are answered from memory; 0 entries or 0 seconds disables the cache
+	CacheMaxEntries int `yaml:"cache_max_entries" env:"CHAT_CACHE_MAX_ENTRIES"`
+	CacheTTLSeconds int `yaml:"cache_ttl_seconds" env:"CHAT_CACHE_TTL_SECONDS"`
+	// CacheSimilarity also reuses answers to reworded questions sharing this
+	// fraction of their words (0-1); 0 only matches identical questions
+	CacheSimilarity float64 `yaml:"cache_similarity" env:"CHAT_CACHE_SIMILARITY"`
+	// Suggestions are curated starter questions listed before those derived from the work history
+	Suggestions []string `yaml:"suggestions" env:"CHAT_SUGGESTIONS"`
+	// FollowUps adds suggested next questions to every chat answer
+	FollowUps bool `yaml:"follow_ups" env:"CHAT_FOLLOW_UPS"`
+	// ClaimCheck is what to do with answers naming companies, technologies or
+	// dates the work history does not: off, disclaimer, rewrite or retry
+	ClaimCheck string `yaml:"claim_check" env:"CHAT_CLAIM_CHECK"`
+	// MaxMessageLength caps chat messages in characters, after normalization
+	MaxMessageLength int `yaml:"max_message_length" env:"CHAT_MAX_MESSAGE_LENGTH"`
+	// InjectionCheck is what to do with messages that look like prompt
+	// injections: off, log or block
+	InjectionCheck string `yaml:"injection_check" env:"CHAT_INJECTION_CHECK"`
+	// Moderation sends every message to the OpenAI moderation endpoint first
+	Moderation bool `yaml:"moderation" env:"CHAT_MODERATION"`
+	// Model settings for questions no route matches
+	Model       string  `yaml:"model" env:"CHAT_MODEL"`
+	MaxTokens   int     `yaml:"max_tokens" env:"CHAT_MAX_TOKENS"`
+	Temperature float64 `yaml:"temperature" env:"CHAT_TEMPERATURE"`
+	// Truncation handles answers cut off at max_tokens: continue or trim
+	Truncation       string `yaml:"truncation" env:"CHAT_TRUNCATION"`
+	MaxContinuations int    `yaml:"max_continuations" env:"CHAT_MAX_CONTINUATIONS"`
+	// Routes send matching questions to other model settings, first match
+	// wins; there are none by default, so upgrades are opt-in
+	Routes []internal.ChatRoute `yaml:"routes"`
+	// PromptTemplates add to, or replace, the built-in "default" template
+	PromptTemplates []internal.PromptTemplate `yaml:"prompt_templates"`
+	// Prompts picks the templates in use with their A/B weights, e.g.
+	// default=90,concise=10; empty uses the default template
+	Prompts internal.PromptWeights `yaml:"prompts" env:"CHAT_PROMPTS"`
+}
+
+// modelParams returns the model settings for questions no route matches
+func (c ChatLimitsConfig) modelParams() internal.ModelParams {
+	return internal.ModelParams{
+		Model:            c.Model,
+		MaxTokens:        c.MaxTokens,
+		Temperature:      c.Temperature,
+		Truncation:       c.Truncation,
+		MaxContinuations: c.MaxContinuations,
+	}
+}
+
+func (c ChatLimitsConfig) validateModels() []error {
+	var errs []error
+	if c.Model == "" {
+		errs = append(errs, errors.New("chat.model is required"))
+	}
+	if c.MaxTokens < 1 {
+		errs = append(errs, fmt.Errorf("chat.max_tokens must be at least 1, got %d", c.MaxTokens))
+	}
+	if c.Temperature < 0 || c.Temperature > 2 {
+		errs = append(errs, fmt.Errorf("chat.temperature must be between 0 and 2, got %v", c.Temperature))
+	}
+	if c.Truncation != internal.TruncationContinue && c.Truncation != internal.TruncationTrim {
+		errs = append(errs, fmt.Errorf("chat.truncation must be continue or trim, got %q", c.Truncation))
+	}
+	if c.MaxContinuations < 0 || c.MaxContinuations > 3 {
+		errs = append(errs, fmt.Errorf("chat.max_continuations must be between 0 and 3, got %d", c.MaxContinuations))
+	}
+
+	names := map[string]bool{}
+	for i, route := range c.Routes {
+		name := route.Name
+		if name == "" {
+			errs = append(errs, fmt.Errorf("chat.routes[%d]: name is required", i))
+			name = strconv.Itoa(i)
+		} else if names[name] {
+			errs = append(errs, fmt.Errorf("chat.routes: duplicate route %q", name))
+		}
+		names[name] = true
+		if route.MinWords == 0 && route.MaxWords == 0 && route.Technical == nil && len(route.Keywords) == 0 {
+			errs = append(errs, fmt.Errorf("chat.routes %s: set min_words, max_words, technical or keywords", name))
+		}
+		if route.MinWords < 0 || route.MaxWords < 0 || (route.MaxWords > 0 && route.MinWords > route.MaxWords) {
+			errs = append(errs, fmt.Errorf("chat.routes %s: min_words and max_words must be positive with min_words <= max_words", name))
+		}
+		if route.MaxTokens < 0 {
+			errs = append(errs, fmt.Errorf("chat.routes %s: max_tokens must be positive, got %d", name, route.MaxTokens))
+		}
+		if route.Temperature != nil && (*route.Temperature < 0 || *route.Temperature > 2) {
+			errs = append(errs, fmt.Errorf("chat.routes %s: temperature must be between 0 and 2, got %v", name, *route.Temperature))
+		}
+		if route.Truncation != "" && route.Truncation != internal.TruncationContinue && route.Truncation != internal.TruncationTrim {
+			errs = append(errs, fmt.Errorf("chat.routes %s: truncation must be continue or trim, got %q", name, route.Truncation))
+		}
+		if route.MaxContinuations != nil && (*route.MaxContinuations < 0 || *route.MaxContinuations > 3) {
+			errs = append(errs, fmt.Errorf("chat.routes %s: max_continuations must be between 0 and 3, got %d", name, *route.MaxContinuations))
+		}
+	}
+	return errs
+}
+
+// unpricedModels lists configured models missing from the price table, whose
+// usage would count as free against the spend cap
+func (c ChatLimitsConfig) unpricedModels() []string {
+	var unpriced []string
+	models := []string{c.Model}
+	for _, route := range c.Routes {
+		if route.Model != "" {
+			models = append(models, route.Model)
+		}
+	}
+	seen := map[string]bool{}
+	for _, model := range models {
+		if seen[model] {
+			continue
+		}
+		seen[model] = true
+		priced := false
+		for name := range c.ModelPrices {
+			// Dated snapshots (gpt-4o-2024-08-06) are priced as the base model
+			priced = priced || strings.HasPrefix(model, name)
+		}
+		if !priced {
+			unpriced = append(unpriced, model)
+		}
+	}
+	return unpriced
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Environment:  "development",
+		Port:         "8080",
+		JWTSecret:    defaultJWTSecret,
+		AuthUsername: "admin",
+		AuthPassword: defaultAuthPassword,
+		AuthRoles:    []string{"visitor"},
+		API: APIConfig{
+			LegacyRoutes:          true,
+			LegacyDeprecatedSince: "2026-10-01",
+			LegacySunset:          "2027-04-01",
+		},
+		Audit: AuditConfig{
+			File: "data/audit.log",
+		},
+		Secrets: SecretsConfig{
+			File:                  "data/secrets.json",
+			KeepVersions:          5,
+			ReloadIntervalSeconds: 30,
+			MetadataRoles:         []string{"operator"},
+		},
+		APIKeys: APIKeysConfig{
+			File:           "data/api_keys.json",
+			DefaultTTLDays: 365,
+		},
+		OIDC: OIDCConfig{
+			Scopes:    []string{"openid", "email", "profile"},
+			Roles:     []string{"admin", "operator"},
+			RoleClaim: "groups",
+		},
+		Session: SessionConfig{
+			CookieName:     "session",
+			Path:           "/",
+			Secure:         true,
+			SameSite:       "lax",
+			CSRFCookieName: "csrf_token",
+			CSRFHeader:     "X-CSRF-Token",
+		},
+		TLS: TLSConfig{
+			ReloadIntervalSeconds: 60,
+			MinVersion:            "1.2",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"https://ethanmerrill.com"},
+			EnvironmentOrigins: map[string][]string{
+				"development": {"http://localhost:3000", "http://localhost:5173"},
+			},
+			AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID", "X-CSRF-Token"},
+			ExposedHeaders:   []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "X-Request-ID"},
+			AllowCredentials: true,
+			MaxAgeSeconds:    600,
+		},
+		Security: SecurityConfig{
+			HSTSMaxAgeSeconds:     31536000,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			MaxBodyBytes:          16 << 10,
+			RouteBodyLimits: map[string]int64{
+				"/auth":        1 << 10,
+				"/api/v1/chat": 8 << 10,
+				"/api/chat":    8 << 10,
+			},
+		},
+		Chat: ChatLimitsConfig{
+			RateLimitPerMinute: 6,
+			RateLimitBurst:     3,
+			DailyQuota:         50,
+			DailyBudgetUSD:     1,
+			MonthlyBudgetUSD:   10,
+			UsageFile:          "data/usage.json",
+			CacheMaxEntries:    500,
+			CacheTTLSeconds:    86400,
+			FollowUps:          true,
+			ClaimCheck:         internal.ClaimCheckDisclaimer,
+			MaxMessageLength:   internal.DefaultMaxMessageLength,
+			InjectionCheck:     internal.InjectionCheckBlock,
+			Model:              internal.DefaultModelParams.Model,
+			MaxTokens:          internal.DefaultModelParams.MaxTokens,
+			Temperature:        internal.DefaultModelParams.Temperature,
+			Truncation:         internal.DefaultModelParams.Truncation,
+			MaxContinuations:   internal.DefaultModelParams.MaxContinuations,
+		},
+	}
+}
+
+// loadConfig builds the configuration from defaults, the config file and the
+// environment. An empty path falls back to CONFIG_FILE, then ./config.yaml if present.
+func loadConfig(path string) (*Config, error) {
+	loadDotenv()
+	config, err := readConfig(path, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	if path := resolveConfigPath(path); path != "" {
+		log.Printf("Loaded config file %s", path)
+	}
+	return config, nil
+}
+
+// envLookup reads an environment variable, like os.LookupEnv
+type envLookup func(key string) (string, bool)
+
+// readConfig is loadConfig without touching the process environment or
+// logging, for reloads: env overrides come from lookup
+func readConfig(path string, lookup envLookup) (*Config, error) {
+	config := defaultConfig()
+
+	path = resolveConfigPath(path)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		// An empty file decodes as io.EOF and simply keeps the defaults
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnvOverrides(reflect.ValueOf(config).Elem(), lookup); err != nil {
+		return nil, err
+	}
+
+	if len(config.Chat.ModelPrices) == 0 {
+		config.Chat.ModelPrices = internal.DefaultModelPrices
+	}
+	return config, nil
+}
+
+// resolveConfigPath applies the CONFIG_FILE and ./config.yaml fallbacks
+func resolveConfigPath(path string) string {
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			path = defaultConfigFile
+		}
+	}
+	return path
+}
+
+// dotenvKeys are the variables loadDotenv set from .env rather than the real
+// environment. It is written at startup only.
+var dotenvKeys = map[string]bool{}
+
+// loadDotenv copies .env into the process environment without overriding
+// variables that are already set
+func loadDotenv() {
+	values, err := godotenv.Read()
+	if err != nil {
+		log.Println("No .env file found, using system environment variables")
+		return
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		os.Setenv(key, value)
+		dotenvKeys[key] = true
+	}
+}
+
+// reloadedEnv rereads .env and returns a lookup that sees it as a fresh
+// start would: the real environment wins, except over variables that only
+// came from .env. The process environment is left alone.
+func reloadedEnv() (envLookup, error) {
+	values, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
+	return func(key string) (string, bool) {
+		if !dotenvKeys[key] {
+			if value, ok := os.LookupEnv(key); ok {
+				return value, true
+			}
+		}
+		value, ok := values[key]
+		return value, ok
+	}, nil
+}
+
+// applyEnvOverrides sets every field with an env tag whose variable is set
+func applyEnvOverrides(v reflect.Value, lookup envLookup) error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		fieldType := t.Field(i)
+
+		if fieldType.Type.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(field, lookup); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		key := fieldType.Tag.Get("env")
+		if key == "" {
+			continue
+		}
+		value, ok := lookup(key)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, value string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(parsed)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+// deprecation parses the legacy route dates into the headers' form
+func (a APIConfig) deprecation() (internal.RouteDeprecation, error) {
+	var deprecation internal.RouteDeprecation
+	since, err := time.Parse("2006-01-02", a.LegacyDeprecatedSince)
+	if err != nil {
+		return deprecation, fmt.Errorf("api.legacy_deprecated_since must be YYYY-MM-DD, got %q", a.LegacyDeprecatedSince)
+	}
+	deprecation.Since = since
+	if a.LegacySunset != "" {
+		sunset, err := time.Parse("2006-01-02", a.LegacySunset)
+		if err != nil {
+			return deprecation, fmt.Errorf("api.legacy_sunset must be YYYY-MM-DD, got %q", a.LegacySunset)
+		}
+		deprecation.Sunset = sunset
+	}
+	return deprecation, nil
+}
+
+// IsProduction reports whether the service runs with production safeguards
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
+}
+
+// Validate checks required fields and value ranges. In production it also
+// rejects default or weak secrets instead of merely warning about them.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Environment {
+	case "development", "production":
+	default:
+		errs = append(errs, fmt.Errorf("environment must be development or production, got %q", c.Environment))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be a number between 1 and 65535, got %q", c.Port))
+	}
+	if c.JWTSecret == "" {
+		errs = append(errs, errors.New("jwt_secret is required"))
+	}
+	if c.AuthUsername == "" {
+		errs = append(errs, errors.New("auth_username is required"))
+	}
+	if c.AuthPassword == "" {
+		errs = append(errs, errors.New("auth_password is required"))
+	}
+
+	if c.Chat.RateLimitPerMinute < 1 {
+		errs = append(errs, errors.New("chat.rate_limit_per_minute must be at least 1"))
+	}
+	if c.Chat.RateLimitBurst < 1 {
+		errs = append(errs, errors.New("chat.rate_limit_burst must be at least 1"))
+	}
+	if c.Chat.DailyQuota < 0 {
+		errs = append(errs, errors.New("chat.daily_quota must not be negative"))
+	}
+	if c.Chat.DailyBudgetUSD < 0 || c.Chat.MonthlyBudgetUSD < 0 {
+		errs = append(errs, errors.New("chat budgets must not be negative"))
+	}
+	if c.Chat.CacheMaxEntries < 0 || c.Chat.CacheTTLSeconds < 0 {
+		errs = append(errs, errors.New("chat.cache_max_entries and chat.cache_ttl_seconds must not be negative"))
+	}
+	if c.Chat.CacheSimilarity < 0 || c.Chat.CacheSimilarity > 1 {
+		errs = append(errs, fmt.Errorf("chat.cache_similarity must be between 0 and 1, got %v", c.Chat.CacheSimilarity))
+	}
+	switch c.Chat.ClaimCheck {
+	case internal.ClaimCheckOff, internal.ClaimCheckDisclaimer, internal.ClaimCheckRewrite, internal.ClaimCheckRetry:
+	default:
+		errs = append(errs, fmt.Errorf("chat.claim_check must be off, disclaimer, rewrite or retry, got %q", c.Chat.ClaimCheck))
+	}
+	if c.Chat.MaxMessageLength < 1 {
+		errs = append(errs, fmt.Errorf("chat.max_message_length must be at least 1, got %d", c.Chat.MaxMessageLength))
+	}
+	switch c.Chat.InjectionCheck {
+	case internal.InjectionCheckOff, internal.InjectionCheckLog, internal.InjectionCheckBlock:
+	default:
+		errs = append(errs, fmt.Errorf("chat.injection_check must be off, log or block, got %q", c.Chat.InjectionCheck))
+	}
+	errs = append(errs, c.Chat.validateModels()...)
+	if _, err := internal.NewPromptTemplates(c.Chat.PromptTemplates, c.Chat.Prompts); err != nil {
+		errs = append(errs, fmt.Errorf("chat.prompts: %w", err))
+	}
+
+	errs = append(errs, c.CORS.validate()...)
+
+	if _, err := c.API.deprecation(); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, c.TLS.validate(c.Port)...)
+
+	if c.Secrets.KeepVersions < 1 {
+		errs = append(errs, errors.New("secrets.keep_versions must be at least 1"))
+	}
+	if c.Secrets.ReloadIntervalSeconds < 1 {
+		errs = append(errs, errors.New("secrets.reload_interval_seconds must be at least 1"))
+	}
+	errs = append(errs, c.OIDC.validate(c.Environment == "production")...)
+	errs = append(errs, c.Session.validate(c.Environment == "production")...)
+
+	if c.APIKeys.DefaultTTLDays < 0 {
+		errs = append(errs, errors.New("api_keys.default_ttl_days must not be negative"))
+	}
+	if _, err := internal.NewSecretPolicyEngine(c.Secrets.policies()); err != nil {
+		errs = append(errs, fmt.Errorf("secrets.policies: %w", err))
+	}
+
+	if c.Admin.Addr != "" {
+		if _, adminPort, err := net.SplitHostPort(c.Admin.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("admin.addr must be host:port, got %q", c.Admin.Addr))
+		} else if adminPort == c.Port || adminPort == c.TLS.RedirectPort {
+			errs = append(errs, errors.New("admin.addr must not share a port with the public listener"))
+		}
+		if c.Admin.Token == "" && !c.OIDC.Enabled() {
+			errs = append(errs, errors.New("admin.addr needs admin.token or OIDC login (oidc.issuer), or nobody can use the admin listener"))
+		}
+	}
+
+	if c.Security.MaxBodyBytes < 1 {
+		errs = append(errs, errors.New("security.max_body_bytes must be at least 1"))
+	}
+	for path, limit := range c.Security.RouteBodyLimits {
+		if limit < 1 {
+			errs = append(errs, fmt.Errorf("security.route_body_limits[%s] must be at least 1", path))
+		}
+	}
+
+	if c.IsProduction() {
+		if c.JWTSecret == defaultJWTSecret || strings.Contains(c.JWTSecret, "change-this") || len(c.JWTSecret) < 32 {
+			errs = append(errs, errors.New("jwt_secret must be a random value of at least 32 characters in production"))
+		}
+		if strings.HasPrefix(c.AuthPassword, defaultAuthPassword) {
+			errs = append(errs, errors.New("auth_password must be changed from the default in production"))
+		}
+		if c.Admin.Token != "" && (len(c.Admin.Token) < 32 || strings.Contains(c.Admin.Token, "change-me")) {
+			errs = append(errs, errors.New("admin.token must be a random value of at least 32 characters in production"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Warnings lists insecure settings that are tolerated outside production
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.JWTSecret == defaultJWTSecret {
+		warnings = append(warnings, "Using default JWT secret. This is insecure for production!")
+	}
+	if strings.HasPrefix(c.AuthPassword, defaultAuthPassword) {
+		warnings = append(warnings, "Using default auth password. This is insecure for production!")
+	}
+	if c.Admin.Addr == "" && c.Admin.Token != "" {
+		warnings = append(warnings, "ADMIN_TOKEN is set but ADMIN_ADDR is not. The admin listener (metrics, pprof, revocation) is disabled.")
+	}
+	if c.Audit.File == "" {
+		warnings = append(warnings, "AUDIT_LOG_FILE is empty. Logins and secret reads will not be audited.")
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled {
+		warnings = append(warnings, "tls.client_ca_file is set but TLS is disabled; admin routes will not require client certificates.")
+	}
+	if c.Session.Cookies && !c.CORS.AllowCredentials {
+		warnings = append(warnings, "session.cookies is on but cors.allow_credentials is off; cross-origin frontends will not send the session cookie.")
+	}
+	if unpriced := c.Chat.unpricedModels(); len(unpriced) > 0 {
+		warnings = append(warnings, fmt.Sprintf("No price configured for chat models %s; their usage will not count toward the spend cap.", strings.Join(unpriced, ", ")))
+	}
+	if c.OpenAIKey == "" {
+		warnings = append(warnings, "OPENAI_API_KEY environment variable is not set. OpenAI functionality will be disabled.")
+	}
+	return warnings
+}
+
+// Redacted returns a copy with every secret field masked
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redactSecrets(reflect.ValueOf(&redacted).Elem())
+	return &redacted
+}
+
+func redactSecrets(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			redactSecrets(field)
+			continue
+		}
+		if t.Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String && field.String() != "" {
+			field.SetString(redactedValue)
+		}
+	}
+}
+
+// runConfigCommand implements `secrets-service config validate|print`
+func runConfigCommand(args []string) int {
+	usage := "usage: secrets-service config validate|print [--config file] [--redacted]"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	configPath := flags.String("config", "", "path to the YAML config file")
+	redacted := flags.Bool("redacted", true, "mask secret values when printing")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "validate":
+		if err := config.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration is invalid:\n%v\n", err)
+			return 1
+		}
+		for _, warning := range config.Warnings() {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+		fmt.Println("configuration is valid")
+		return 0
+	case "print":
+		if *redacted {
+			config = config.Redacted()
+		}
+		out, err := yaml.Marshal(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to render configuration: %v\n", err)
+			return 1
+		}
+		fmt.Print(string(out))
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
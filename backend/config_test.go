@@ -0,0 +1,245 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"portfolio-secrets-service/internal"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileWithEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, `
+port: "9000"
+auth_username: portfolio
+chat:
+  daily_quota: 20
+  model_prices:
+    gpt-4o-mini:
+      prompt_per_1k: 0.00015
+      completion_per_1k: 0.0006
+`)
+	t.Setenv("CHAT_DAILY_QUOTA", "5")
+	t.Setenv("TRUST_PROXY_HEADERS", "true")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Port != "9000" || config.AuthUsername != "portfolio" {
+		t.Errorf("file values not applied: port=%s username=%s", config.Port, config.AuthUsername)
+	}
+	if config.Chat.DailyQuota != 5 {
+		t.Errorf("env override not applied: daily_quota=%d", config.Chat.DailyQuota)
+	}
+	if !config.TrustProxyHeaders {
+		t.Error("expected TRUST_PROXY_HEADERS to be applied")
+	}
+	if config.Chat.RateLimitBurst != 3 {
+		t.Errorf("expected default burst to survive, got %d", config.Chat.RateLimitBurst)
+	}
+	if config.Chat.ModelPrices["gpt-4o-mini"].CompletionPer1K != 0.0006 {
+		t.Errorf("model prices not loaded: %+v", config.Chat.ModelPrices)
+	}
+}
+
+func TestLoadConfigChatRoutes(t *testing.T) {
+	path := writeConfigFile(t, `
+chat:
+  max_tokens: 200
+  routes:
+    - name: hiring
+      keywords: [hire, salary]
+      model: gpt-4o
+      temperature: 0
+      truncation: trim
+`)
+	t.Setenv("CHAT_MODEL", "gpt-4o-mini")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := config.Chat.modelParams()
+	if params.Model != "gpt-4o-mini" || params.MaxTokens != 200 || params.Temperature != 0.7 {
+		t.Errorf("model params = %+v", params)
+	}
+	if len(config.Chat.Routes) != 1 || config.Chat.Routes[0].Temperature == nil || *config.Chat.Routes[0].Temperature != 0 {
+		t.Fatalf("routes = %+v", config.Chat.Routes)
+	}
+
+	config.Chat.Routes = append(config.Chat.Routes, internal.ChatRoute{Name: "hiring", Model: "gpt-5-preview"})
+	err = config.Validate()
+	if err == nil || !strings.Contains(err.Error(), `duplicate route "hiring"`) || !strings.Contains(err.Error(), "set min_words, max_words, technical or keywords") {
+		t.Errorf("expected route errors, got %v", err)
+	}
+	if warnings := strings.Join(config.Warnings(), "\n"); !strings.Contains(warnings, "chat models gpt-5-preview;") {
+		t.Errorf("expected a price warning for the unpriced model only, got %q", warnings)
+	}
+}
+
+func TestLoadConfigPromptTemplates(t *testing.T) {
+	path := writeConfigFile(t, `
+chat:
+  prompt_templates:
+    - name: concise
+      version: "2"
+      text: "{{.WorkHistoryExcerpt}}\nAnswer in one sentence."
+  prompts:
+    default: 1
+`)
+	t.Setenv("CHAT_PROMPTS", "default=90,concise=10")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (internal.PromptWeights{"default": 90, "concise": 10}); !reflect.DeepEqual(config.Chat.Prompts, want) {
+		t.Errorf("prompts = %v, want %v", config.Chat.Prompts, want)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected prompt templates to be valid: %v", err)
+	}
+
+	config.Chat.Prompts = internal.PromptWeights{"verbose": 1}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), `chat.prompts: prompt "verbose" has no template`) {
+		t.Errorf("expected an unknown prompt error, got %v", err)
+	}
+}
+
+func TestReloadedEnvLeavesProcessEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// FIREBASE_API_KEY came from .env at startup, OPENAI_API_KEY from the real environment
+	t.Setenv("FIREBASE_API_KEY", "fb-at-startup")
+	t.Setenv("OPENAI_API_KEY", "sk-real")
+	dotenvKeys["FIREBASE_API_KEY"] = true
+	t.Cleanup(func() { delete(dotenvKeys, "FIREBASE_API_KEY") })
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("FIREBASE_API_KEY=fb-rotated\nOPENAI_API_KEY=sk-dotenv\n"), 0o600)
+
+	lookup, err := reloadedEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := readConfig("", lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.FirebaseKey != "fb-rotated" || config.OpenAIKey != "sk-real" {
+		t.Errorf("reloaded keys = %q, %q", config.FirebaseKey, config.OpenAIKey)
+	}
+	if os.Getenv("FIREBASE_API_KEY") != "fb-at-startup" {
+		t.Error("reload changed the process environment")
+	}
+}
+
+func TestLoadConfigRejectsBadValues(t *testing.T) {
+	if _, err := loadConfig(writeConfigFile(t, "unknown_setting: true\n")); err == nil {
+		t.Error("expected unknown config keys to be rejected")
+	}
+
+	t.Setenv("CHAT_DAILY_QUOTA", "lots")
+	_, err := loadConfig(writeConfigFile(t, ""))
+	if err == nil || !strings.Contains(err.Error(), "CHAT_DAILY_QUOTA") {
+		t.Errorf("expected a type error for CHAT_DAILY_QUOTA, got %v", err)
+	}
+}
+
+func TestValidateRefusesDefaultSecretsInProduction(t *testing.T) {
+	config := defaultConfig()
+	if err := config.Validate(); err != nil {
+		t.Fatalf("defaults should be valid in development: %v", err)
+	}
+
+	config.Environment = "production"
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected default secrets to be rejected in production")
+	}
+	for _, want := range []string{"jwt_secret", "auth_password"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %s in validation error, got %v", want, err)
+		}
+	}
+
+	config.API.LegacySunset = "April 2027"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "api.legacy_sunset") {
+		t.Errorf("expected a date error for api.legacy_sunset, got %v", err)
+	}
+	config.API.LegacySunset = "2027-04-01"
+
+	config.Secrets.Policies = map[string]internal.SecretPolicy{"openai": {Exposure: "partial"}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "secrets.policies: policy for openai") {
+		t.Errorf("expected a policy error, got %v", err)
+	}
+	config.Secrets.Policies = nil
+
+	config.OIDC.Issuer = "http://idp.example.com"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "oidc.allowed_emails") || !strings.Contains(err.Error(), "oidc.issuer must use https") {
+		t.Errorf("expected OIDC errors, got %v", err)
+	}
+	config.OIDC.Issuer = ""
+
+	config.Session.Cookies, config.Session.SameSite, config.Session.Secure = true, "none", false
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "session.same_site none requires session.secure") {
+		t.Errorf("expected a session cookie error, got %v", err)
+	}
+	config.Session.SameSite, config.Session.Secure = "lax", true
+
+	config.Chat.ClaimCheck = "ignore"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "chat.claim_check") {
+		t.Errorf("expected a claim check error, got %v", err)
+	}
+	config.Chat.ClaimCheck = "retry"
+
+	config.Chat.InjectionCheck, config.Chat.MaxMessageLength = "warn", 0
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "chat.injection_check") || !strings.Contains(err.Error(), "chat.max_message_length") {
+		t.Errorf("expected chat input errors, got %v", err)
+	}
+	config.Chat.InjectionCheck, config.Chat.MaxMessageLength = "log", 500
+
+	config.Admin.Addr = "127.0.0.1:9090"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "admin.addr needs admin.token or OIDC login") {
+		t.Errorf("expected an admin credential error, got %v", err)
+	}
+	config.Admin.Token = strings.Repeat("a", 32)
+
+	config.JWTSecret = strings.Repeat("k", 48)
+	config.AuthPassword = "a-real-password"
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected production config to be valid: %v", err)
+	}
+}
+
+func TestRedactedConfig(t *testing.T) {
+	config := defaultConfig()
+	config.OpenAIKey = "sk-live"
+
+	redacted := config.Redacted()
+	if redacted.OpenAIKey != redactedValue || redacted.JWTSecret != redactedValue {
+		t.Errorf("secrets not redacted: %+v", redacted)
+	}
+	if redacted.FirebaseKey != "" {
+		t.Error("unset secrets should stay empty")
+	}
+	if config.OpenAIKey != "sk-live" || redacted.AuthUsername != config.AuthUsername {
+		t.Error("redaction must not modify the original or non-secret fields")
+	}
+}
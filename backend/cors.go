@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+var defaultCORSMethods = []string{"GET", "POST", "OPTIONS"}
+
+// newCORSHandler wraps next with the configured CORS policy. Requests under a
+// route override's path prefix use that override (longest prefix wins).
+func newCORSHandler(cfg CORSConfig, environment string, next http.Handler) http.Handler {
+	origins := cfg.originsFor(environment)
+	log.Printf("CORS configured with origins: %v", origins)
+
+	fallback := cors.New(cors.Options{
+		AllowedOrigins:   origins,
+		AllowedMethods:   defaultCORSMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAgeSeconds,
+	}).Handler(next)
+
+	type routeHandler struct {
+		prefix  string
+		handler http.Handler
+	}
+	var routes []routeHandler
+	for _, route := range cfg.Routes {
+		options := cors.Options{
+			AllowedOrigins:   route.AllowedOrigins,
+			AllowedMethods:   route.AllowedMethods,
+			AllowedHeaders:   route.AllowedHeaders,
+			ExposedHeaders:   cfg.ExposedHeaders,
+			AllowCredentials: route.AllowCredentials,
+			MaxAge:           route.MaxAgeSeconds,
+		}
+		if len(options.AllowedOrigins) == 0 {
+			options.AllowedOrigins = origins
+		}
+		if len(options.AllowedMethods) == 0 {
+			options.AllowedMethods = defaultCORSMethods
+		}
+		if len(options.AllowedHeaders) == 0 {
+			options.AllowedHeaders = cfg.AllowedHeaders
+		}
+		if options.MaxAge == 0 {
+			options.MaxAge = cfg.MaxAgeSeconds
+		}
+
+		log.Printf("CORS override for %s: origins %v, credentials %t", route.PathPrefix, options.AllowedOrigins, options.AllowCredentials)
+		routes = append(routes, routeHandler{prefix: route.PathPrefix, handler: cors.New(options).Handler(next)})
+	}
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i].prefix) > len(routes[j].prefix) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, route := range routes {
+			if strings.HasPrefix(r.URL.Path, route.prefix) {
+				route.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// originsFor returns the shared origins plus those for the given environment
+func (c CORSConfig) originsFor(environment string) []string {
+	origins := append([]string{}, c.AllowedOrigins...)
+	return append(origins, c.EnvironmentOrigins[environment]...)
+}
+
+func (c CORSConfig) validate() []error {
+	var errs []error
+
+	check := func(where string, origins []string, credentials bool) {
+		for _, origin := range origins {
+			if err := validateOriginPattern(origin); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			}
+			if origin == "*" && credentials {
+				errs = append(errs, fmt.Errorf("%s: origin \"*\" cannot be combined with allow_credentials", where))
+			}
+		}
+	}
+
+	check("cors.allowed_origins", c.AllowedOrigins, c.AllowCredentials)
+	for environment, origins := range c.EnvironmentOrigins {
+		check("cors.environment_origins."+environment, origins, c.AllowCredentials)
+	}
+	for i, route := range c.Routes {
+		where := fmt.Sprintf("cors.routes[%d]", i)
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			errs = append(errs, fmt.Errorf("%s: path_prefix must start with /", where))
+		}
+		check(where, route.AllowedOrigins, route.AllowCredentials)
+	}
+	if c.MaxAgeSeconds < 0 {
+		errs = append(errs, fmt.Errorf("cors.max_age_seconds must not be negative"))
+	}
+	return errs
+}
+
+// validateOriginPattern accepts "*" or scheme://host[:port] with at most one wildcard
+func validateOriginPattern(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("origin %q may contain at most one wildcard", origin)
+	}
+	parsed, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("origin %q must look like https://example.com", origin)
+	}
+	if parsed.Path != "" || parsed.RawQuery != "" {
+		return fmt.Errorf("origin %q must not contain a path", origin)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func corsResponse(handler http.Handler, method, path, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Origin", origin)
+	if method == "OPTIONS" {
+		req.Header.Set("Access-Control-Request-Method", "GET")
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCORSPolicy(t *testing.T) {
+	cfg := defaultConfig().CORS
+	cfg.AllowedOrigins = append(cfg.AllowedOrigins, "https://*.ethanmerrill.com")
+	cfg.Routes = []CORSRoutePolicy{{PathPrefix: "/api/public", AllowedOrigins: []string{"*"}}}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	production := newCORSHandler(cfg, "production", next)
+	development := newCORSHandler(cfg, "development", next)
+
+	tests := []struct {
+		name        string
+		handler     http.Handler
+		path        string
+		origin      string
+		wantOrigin  string
+		credentials bool
+	}{
+		{"exact origin", production, "/api/chat", "https://ethanmerrill.com", "https://ethanmerrill.com", true},
+		{"wildcard subdomain", production, "/api/chat", "https://staging.ethanmerrill.com", "https://staging.ethanmerrill.com", true},
+		{"localhost not allowed in production", production, "/api/chat", "http://localhost:5173", "", false},
+		{"localhost allowed in development", development, "/api/chat", "http://localhost:5173", "http://localhost:5173", true},
+		{"public route open to any origin", production, "/api/public/resume", "https://example.org", "*", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := corsResponse(tt.handler, "GET", tt.path, tt.origin)
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("credentials = %t, want %t", got, tt.credentials)
+			}
+		})
+	}
+
+	rr := corsResponse(production, "OPTIONS", "/api/chat", "https://ethanmerrill.com")
+	if rr.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("expected max-age on preflight, got %q", rr.Header().Get("Access-Control-Max-Age"))
+	}
+}
+
+func TestCORSValidation(t *testing.T) {
+	cfg := defaultConfig().CORS
+	cfg.AllowedOrigins = []string{"*", "ethanmerrill.com", "https://*.*.example.com"}
+	if errs := cfg.validate(); len(errs) != 3 {
+		t.Errorf("expected 3 validation errors, got %v", errs)
+	}
+}
@@ -7,4 +7,5 @@ require (
 	github.com/gorilla/mux v1.8.1
 	github.com/joho/godotenv v1.5.1
 	github.com/rs/cors v1.11.1
+	gopkg.in/yaml.v3 v3.0.1
 )
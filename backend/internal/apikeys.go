@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyPrefix starts every key so leaked keys are easy to search for
+const APIKeyPrefix = "psk_"
+
+var (
+	ErrAPIKeyInvalid = errors.New("invalid API key")
+	ErrAPIKeyExpired = errors.New("API key expired")
+	ErrAPIKeyRevoked = errors.New("API key revoked")
+)
+
+// apiKeyLastUsedInterval limits how often last-used times are written to disk
+const apiKeyLastUsedInterval = time.Minute
+
+// APIKey describes a machine client key. Only the SHA-256 hash of the key is
+// stored; the key itself is shown once, when minted.
+type APIKey struct {
+	// ID is the public part of the key after the prefix, e.g. "k3f9a1b2"
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"hash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Prefix is the non-secret start of the key, safe to log and display
+func (k APIKey) Prefix() string {
+	return APIKeyPrefix + k.ID
+}
+
+// APIKeyStore keeps API keys in a JSON file with mode 0600
+type APIKeyStore struct {
+	mu        sync.Mutex
+	path      string
+	keys      map[string]*APIKey // by ID
+	lastSaved time.Time
+	now       func() time.Time
+}
+
+// NewAPIKeyStore loads the store at path; a missing file is an empty store
+// and an empty path keeps keys in memory only
+func NewAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{path: path, keys: map[string]*APIKey{}, now: time.Now}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading API keys file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.keys); err != nil {
+		return nil, fmt.Errorf("parsing API keys file: %w", err)
+	}
+	return s, nil
+}
+
+// Mint creates a key and returns it with the full key string, which cannot
+// be recovered later. A zero expiresAt never expires.
+func (s *APIKeyStore) Mint(name string, scopes []string, expiresAt time.Time) (APIKey, string, error) {
+	idBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return APIKey{}, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return APIKey{}, "", err
+	}
+	key := &APIKey{
+		ID:        hex.EncodeToString(idBytes),
+		Name:      name,
+		Scopes:    append([]string{}, scopes...),
+		CreatedAt: s.now().UTC(),
+	}
+	if !expiresAt.IsZero() {
+		expiresAt = expiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+	plaintext := key.Prefix() + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	key.Hash = hashAPIKey(plaintext)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.keys[key.ID]; exists {
+		return APIKey{}, "", errors.New("API key ID collision, try again")
+	}
+	s.keys[key.ID] = key
+	if err := s.save(); err != nil {
+		delete(s.keys, key.ID)
+		return APIKey{}, "", err
+	}
+	return *key, plaintext, nil
+}
+
+// Verify checks a presented key and records its use
+func (s *APIKeyStore) Verify(plaintext string) (APIKey, error) {
+	if s == nil {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	id, ok := apiKeyID(plaintext)
+	if !ok {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	hash := hashAPIKey(plaintext)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) != 1 {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	now := s.now().UTC()
+	if key.RevokedAt != nil {
+		return *key, ErrAPIKeyRevoked
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return *key, ErrAPIKeyExpired
+	}
+	key.LastUsedAt = &now
+	if now.Sub(s.lastSaved) >= apiKeyLastUsedInterval {
+		// Best effort: a failed write only loses the last-used time
+		s.save()
+	}
+	return *key, nil
+}
+
+// Revoke disables a key; it stays listed with its revocation time
+func (s *APIKeyStore) Revoke(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyInvalid
+	}
+	if key.RevokedAt == nil {
+		now := s.now().UTC()
+		key.RevokedAt = &now
+		if err := s.save(); err != nil {
+			key.RevokedAt = nil
+			return APIKey{}, err
+		}
+	}
+	return *key, nil
+}
+
+// List returns all keys, oldest first
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys
+}
+
+// apiKeyID extracts the ID from psk_<id>_<secret>
+func apiKeyID(plaintext string) (string, bool) {
+	rest, ok := strings.CutPrefix(plaintext, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	return id, ok && id != "" && secret != ""
+}
+
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *APIKeyStore) save() error {
+	s.lastSaved = s.now()
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	store, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	key, plaintext, err := store.Mint("deploy-bot", []string{"operator"}, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plaintext, key.Prefix()+"_") || len(key.ID) != 8 {
+		t.Errorf("key %q does not start with prefix %q", plaintext, key.Prefix())
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), plaintext[len(key.Prefix())+1:]) {
+		t.Error("API keys file contains the plaintext key")
+	}
+
+	// Last-used times are written at most once a minute
+	now = now.Add(2 * time.Minute)
+	verified, err := store.Verify(plaintext)
+	if err != nil || verified.Name != "deploy-bot" || verified.LastUsedAt == nil || !verified.LastUsedAt.Equal(now) {
+		t.Fatalf("Verify = %+v, %v", verified, err)
+	}
+	for _, bad := range []string{"", "psk_", "sk-abc", key.Prefix() + "_wrong", "psk_00000000_" + plaintext[len(key.Prefix())+1:]} {
+		if _, err := store.Verify(bad); !errors.Is(err, ErrAPIKeyInvalid) {
+			t.Errorf("Verify(%q) err = %v, want invalid", bad, err)
+		}
+	}
+
+	// Reloading keeps keys and the last-used time
+	reloaded, err := NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.now = store.now
+	if keys := reloaded.List(); len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("reloaded keys = %+v", keys)
+	}
+
+	now = now.Add(25 * time.Hour)
+	if _, err := reloaded.Verify(plaintext); !errors.Is(err, ErrAPIKeyExpired) {
+		t.Errorf("expired key: err = %v", err)
+	}
+
+	_, other, _ := reloaded.Mint("ci", nil, time.Time{})
+	if _, err := reloaded.Revoke(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Verify(plaintext); !errors.Is(err, ErrAPIKeyRevoked) {
+		t.Errorf("revoked key: err = %v", err)
+	}
+	if _, err := reloaded.Verify(other); err != nil {
+		t.Errorf("non-expiring key: err = %v", err)
+	}
+	if _, err := reloaded.Revoke("missing"); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("revoke unknown key: err = %v", err)
+	}
+}
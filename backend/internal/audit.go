@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditAuthAttempt = "auth.attempt"
+	AuditTokenIssue  = "token.issue"
+	AuditSecretRead  = "secret.read"
+	AuditSecretList  = "secret.list"
+
+	AuditSecretCreate   = "secret.create"
+	AuditSecretUpdate   = "secret.update"
+	AuditSecretRotate   = "secret.rotate"
+	AuditSecretRollback = "secret.rollback"
+	AuditSecretDelete   = "secret.delete"
+
+	AuditAPIKeyMint   = "apikey.mint"
+	AuditAPIKeyRevoke = "apikey.revoke"
+)
+
+// Audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure" // bad credentials or input
+	AuditDenied  = "denied"  // authenticated but not allowed
+	AuditError   = "error"   // server-side problem
+)
+
+// AuditEvent is one entry in the audit log. Each entry's Hash covers its
+// content and the previous entry's hash, so editing, removing or reordering
+// entries breaks the chain.
+type AuditEvent struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	Version   int       `json:"version,omitempty"`
+	TokenID   string    `json:"token_id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// computeHash hashes the event with its Hash field cleared
+func (e AuditEvent) computeHash() string {
+	e.Hash = ""
+	content, _ := json.Marshal(e)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLog appends hash-chained events to a JSON-lines file. A nil
+// *AuditLog records nothing.
+type AuditLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	seq      int64
+	lastHash string
+	now      func() time.Time
+}
+
+// OpenAuditLog opens (or creates) the log at path and continues its chain.
+// A log with unreadable entries is refused; run `audit verify` to inspect it.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	a := &AuditLog{path: path, now: time.Now}
+
+	err := readAuditEvents(path, func(event AuditEvent) error {
+		a.seq, a.lastHash = event.Seq, event.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading audit log %s: %w", path, err)
+	}
+
+	a.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Record fills in the sequence number, time and chain hashes and appends
+// the event. It is synced to disk before returning.
+func (a *AuditLog) Record(event AuditEvent) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	event.Seq = a.seq + 1
+	event.Time = a.now().UTC()
+	event.PrevHash = a.lastHash
+	event.Hash = event.computeHash()
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	a.seq, a.lastHash = event.Seq, event.Hash
+	return nil
+}
+
+// Close closes the underlying file
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// AuditFilter selects events for Query. Zero fields match everything.
+type AuditFilter struct {
+	Action  string
+	Outcome string
+	Subject string
+	Secret  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int // most recent N matches, 0 for all
+}
+
+func (f AuditFilter) matches(event AuditEvent) bool {
+	return (f.Action == "" || event.Action == f.Action) &&
+		(f.Outcome == "" || event.Outcome == f.Outcome) &&
+		(f.Subject == "" || event.Subject == f.Subject) &&
+		(f.Secret == "" || event.Secret == f.Secret) &&
+		(f.Since.IsZero() || !event.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || event.Time.Before(f.Until))
+}
+
+// Query returns matching events, oldest first
+func (a *AuditLog) Query(filter AuditFilter) ([]AuditEvent, error) {
+	if a == nil {
+		return nil, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	events := []AuditEvent{}
+	err := readAuditEvents(a.path, func(event AuditEvent) error {
+		if filter.matches(event) {
+			events = append(events, event)
+			if filter.Limit > 0 && len(events) > filter.Limit {
+				events = events[1:]
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// AuditVerification summarizes a verified chain
+type AuditVerification struct {
+	Events   int64
+	HeadHash string // record this somewhere else to detect truncation later
+}
+
+// VerifyAuditLog checks every entry's hash, sequence number and link to the
+// previous entry, and reports the first break.
+func VerifyAuditLog(path string) (AuditVerification, error) {
+	var result AuditVerification
+	err := readAuditEvents(path, func(event AuditEvent) error {
+		switch {
+		case event.Seq != result.Events+1:
+			return fmt.Errorf("entry %d: expected sequence %d (entries missing or reordered)", event.Seq, result.Events+1)
+		case event.PrevHash != result.HeadHash:
+			return fmt.Errorf("entry %d: prev_hash does not match the previous entry", event.Seq)
+		case event.Hash != event.computeHash():
+			return fmt.Errorf("entry %d: content does not match its hash (modified)", event.Seq)
+		}
+		result.Events, result.HeadHash = event.Seq, event.Hash
+		return nil
+	})
+	return result, err
+}
+
+// readAuditEvents calls fn for each entry in file order
+func readAuditEvents(path string, fn func(AuditEvent) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) > 0 {
+			var event AuditEvent
+			if jsonErr := json.Unmarshal(raw, &event); jsonErr != nil {
+				return fmt.Errorf("line %d is not a valid audit entry: %w", line, jsonErr)
+			}
+			if fnErr := fn(event); fnErr != nil {
+				return fnErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog.Record(AuditEvent{Action: AuditAuthAttempt, Outcome: AuditFailure, Subject: "mallory"})
+	auditLog.Record(AuditEvent{Action: AuditAuthAttempt, Outcome: AuditSuccess, Subject: "visitor"})
+	auditLog.Close()
+
+	// Reopening continues the chain
+	auditLog, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog.Record(AuditEvent{Action: AuditSecretRead, Outcome: AuditSuccess, Subject: "visitor", Secret: "openai"})
+	auditLog.Close()
+
+	result, err := VerifyAuditLog(path)
+	if err != nil || result.Events != 3 || result.HeadHash == "" {
+		t.Fatalf("VerifyAuditLog = %+v, %v", result, err)
+	}
+
+	original, _ := os.ReadFile(path)
+	lines := strings.SplitAfter(strings.TrimSuffix(string(original), "\n"), "\n")
+
+	tampered := map[string]string{
+		"modified":  strings.Replace(string(original), `"subject":"mallory"`, `"subject":"alice"`, 1),
+		"deleted":   lines[0] + lines[2],
+		"reordered": lines[1] + lines[0] + lines[2],
+	}
+	for name, content := range tampered {
+		os.WriteFile(path, []byte(content), 0o600)
+		if _, err := VerifyAuditLog(path); err == nil {
+			t.Errorf("%s log passed verification", name)
+		}
+	}
+}
+
+func TestAuditLogQuery(t *testing.T) {
+	auditLog, err := OpenAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	auditLog.now = func() time.Time { return now }
+	for _, secret := range []string{"openai", "firebase", "openai", "openai"} {
+		auditLog.Record(AuditEvent{Action: AuditSecretRead, Outcome: AuditSuccess, Secret: secret})
+		now = now.Add(time.Hour)
+	}
+
+	events, err := auditLog.Query(AuditFilter{Secret: "openai", Limit: 2})
+	if err != nil || len(events) != 2 || events[0].Seq != 3 || events[1].Seq != 4 {
+		t.Errorf("Query(secret=openai, limit=2) = %+v, %v", events, err)
+	}
+
+	since := time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)
+	events, _ = auditLog.Query(AuditFilter{Since: since, Until: since.Add(2 * time.Hour)})
+	if len(events) != 2 || events[0].Secret != "firebase" {
+		t.Errorf("Query(since, until) = %+v", events)
+	}
+}
@@ -2,96 +2,274 @@ package internal
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type ChatRequest struct {
 	Message string `json:"message"`
+	// ConversationID keeps a visitor on the same prompt template across
+	// messages; the server assigns one when it is empty
+	ConversationID string `json:"conversation_id,omitempty"`
 }
 
 type ChatResponse struct {
-	Response string `json:"response,omitempty"`
-	Error    string `json:"error,omitempty"`
+	Response       string `json:"response,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	// PromptTemplate is the name@version of the template that produced the answer
+	PromptTemplate string `json:"prompt_template,omitempty"`
+	Fallback       bool   `json:"fallback,omitempty"`
+	Cached         bool   `json:"cached,omitempty"`
+	// Citations are the work history sections the answer drew on
+	Citations []Citation `json:"citations,omitempty"`
+	// Uncited is set when an answer cites no work history section
+	Uncited bool `json:"uncited,omitempty"`
+	// FollowUps are suggested next questions, when enabled
+	FollowUps []string `json:"follow_ups,omitempty"`
 }
 
 type ChatConfig struct {
 	OpenAIKey string
+	// CompletionsURL overrides the OpenAI endpoint (used by tests)
+	CompletionsURL string
 }
 
+const openAICompletionsURL = "https://api.openai.com/v1/chat/completions"
+
 type ChatService struct {
 	Config *ChatConfig
+	Usage  *UsageTracker
+	// Model is used for questions no route matches; zero uses DefaultModelParams
+	Model ModelParams
+	// Prompts are the system prompt templates; nil uses DefaultPromptTemplate
+	Prompts *PromptTemplates
+	// Routes send matching questions to other model parameters, first match wins
+	Routes []ChatRoute
+	// Secrets, when set, supplies the "openai" key on every request so a
+	// rotated key is used without a restart; Config.OpenAIKey is ignored
+	Secrets SecretStores
+	// Cache, when set, answers repeated questions without calling OpenAI
+	Cache *ChatCache
+	// Suggestions are the curated starter questions; empty uses DefaultChatSuggestions
+	Suggestions []string
+	// FollowUps adds suggested next questions to every answer
+	FollowUps bool
+	// ClaimCheck is what to do with answers making claims the work history
+	// does not support: one of the ClaimCheck modes; empty is off
+	ClaimCheck string
+	// MaxMessageLength caps messages in characters; 0 uses DefaultMaxMessageLength
+	MaxMessageLength int
+	// InjectionCheck is off, log or block for messages matching injection patterns; empty is off
+	InjectionCheck string
+	// Moderator, when set, rejects messages it flags
+	Moderator Moderator
+	Metrics   *Metrics
+}
+
+// FallbackResponse is served instead of calling OpenAI once the spend cap is reached
+const FallbackResponse = "Ethan's AI assistant is taking a break for now. In the meantime you can read about his experience on this page or reach out to him directly on LinkedIn."
+
+// openAIChatCompletion is the subset of the chat completions response we use
+type openAIChatCompletion struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// PromptVersion identifies a system prompt; it changes whenever the prompt or
+// the work history in it changes
+func PromptVersion(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
 }
 
 func NewChatService(openAIKey string) *ChatService {
 	return &ChatService{Config: &ChatConfig{OpenAIKey: openAIKey}}
 }
 
+// OpenAIKey returns the current OpenAI key, or "" when none is configured
+func (s *ChatService) OpenAIKey() string {
+	if s.Secrets == nil {
+		return s.Config.OpenAIKey
+	}
+	secret, err := s.Secrets.Get("openai")
+	if err != nil {
+		return ""
+	}
+	return secret.Value
+}
+
 // ChatHandler handles chat requests and proxies to OpenAI
 func (s *ChatService) ChatHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("/api/chat called from %s", r.RemoteAddr)
 
-	if s.Config.OpenAIKey == "" {
+	// Read the key once so a rotation mid-request cannot mix keys
+	openAIKey := s.OpenAIKey()
+	if openAIKey == "" {
 		log.Printf("OpenAI API key not configured")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "OpenAI API key not configured"})
+		WriteError(w, r, http.StatusInternalServerError, CodeChatDisabled, "OpenAI API key not configured")
 		return
 	}
 
 	var req ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := DecodeJSON(r, &req, true); err != nil {
 		log.Printf("Invalid chat request body: %v", err)
+		WriteDecodeError(w, r, err)
+		return
+	}
+
+	message, rejected := s.screenMessage(r.Context(), req.Message)
+	if rejected != nil {
+		writeChatError(w, r, rejected)
+		return
+	}
+	req.Message = message
+
+	conversationID := req.ConversationID
+	if conversationID == "" {
+		conversationID = newConversationID()
+	} else if !validConversationID(conversationID) {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "conversation_id must be 1-64 letters, digits, '-' or '_'")
+		return
+	}
+	prompts := s.prompts()
+	assigned := prompts.assign(conversationID)
+	locale := VisitorLocale(r.Header.Get("Accept-Language"))
+	variant := assigned.ID()
+	if assigned.usesLocale() {
+		variant += " " + locale
+	}
+	base := ChatResponse{ConversationID: conversationID, PromptTemplate: assigned.ID()}
+
+	// Cached answers cost nothing, so they are served even when the budget is spent
+	if cached, ok := s.Cache.GetVariant(prompts.Version(), variant, req.Message); ok {
+		base.Cached = true
+		response := s.answer(req.Message, cached, base)
+		s.logExchange(conversationID, assigned, "cache", response)
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "Invalid request body"})
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if s.Usage != nil {
+		if exceeded, reason := s.Usage.BudgetExceeded(); exceeded {
+			log.Printf("Chat budget cap active (%s), serving fallback response", reason)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ChatResponse{Response: FallbackResponse, Fallback: true, ConversationID: conversationID})
+			return
+		}
+	}
+
+	prompt, err := assigned.render(req.Message, locale, time.Now())
+	if err != nil {
+		log.Printf("Failed to render prompt template %s: %v", assigned.ID(), err)
+		WriteError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to prepare the prompt")
 		return
 	}
+	messages := []map[string]string{
+		{"role": "system", "content": prompt},
+		{"role": "user", "content": req.Message},
+	}
+	route, params := s.route(req.Message)
+	log.Printf("Chat question routed to %s (%s)", route, params.Model)
+	s.Metrics.Inc("chat_routes_total", "Chat questions sent to OpenAI, by route and model.", "route", route, "model", params.Model)
+	aiResponse, chatErr := s.completeAnswer(openAIKey, params, messages)
+	if chatErr != nil {
+		writeChatError(w, r, chatErr)
+		return
+	}
+	aiResponse = s.checkClaims(openAIKey, params, messages, req.Message, aiResponse)
+	aiResponse = s.checkPromptLeak(assigned, aiResponse)
+
+	// The raw answer is cached so citations are extracted the same way on a hit
+	s.Cache.PutVariant(prompts.Version(), variant, req.Message, aiResponse)
+	response := s.answer(req.Message, aiResponse, base)
+	s.logExchange(conversationID, assigned, route, response)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *ChatService) prompts() *PromptTemplates {
+	if s.Prompts != nil {
+		return s.Prompts
+	}
+	return defaultPromptTemplates()
+}
+
+// logExchange records an answered message with the prompt template version
+// that produced it, so versions can be compared
+func (s *ChatService) logExchange(conversationID string, prompt *activePrompt, route string, response ChatResponse) {
+	log.Printf("Chat exchange: conversation=%s prompt=%s route=%s cached=%t citations=%d",
+		conversationID, prompt.ID(), route, response.Cached, len(response.Citations))
+	s.Metrics.Inc("chat_prompt_exchanges_total", "Chat answers by prompt template version.", "prompt", prompt.Name, "version", prompt.Version)
+}
+
+// chatError is a rejected message or failed call to OpenAI, reported to the client as is
+type chatError struct {
+	status     int
+	code       ErrorCode
+	message    string
+	retryAfter time.Duration
+}
 
-	// Import work history context
-	importedPrompt := WorkHistoryPrompt + "\n\nYou are Ethan's AI assistant on his portfolio website. Be helpful, professional, and represent Ethan well. Keep responses concise and engaging. Reference the work history above if relevant."
+func (e *chatError) Error() string { return e.message }
 
+func writeChatError(w http.ResponseWriter, r *http.Request, err *chatError) {
+	if err.status == http.StatusTooManyRequests {
+		WriteErrorRetryAfter(w, r, err.status, err.code, err.message, err.retryAfter)
+		return
+	}
+	WriteError(w, r, err.status, err.code, err.message)
+}
+
+// complete sends messages to OpenAI, records the tokens used and returns the
+// answer with its finish reason
+func (s *ChatService) complete(openAIKey string, params ModelParams, messages []map[string]string) (string, string, *chatError) {
 	openaiReq := map[string]interface{}{
-		"model": "gpt-3.5-turbo",
-		"messages": []map[string]string{
-			{"role": "system", "content": importedPrompt},
-			{"role": "user", "content": req.Message},
-		},
-		"max_tokens":  150,
-		"temperature": 0.7,
+		"model":       params.Model,
+		"messages":    messages,
+		"max_tokens":  params.MaxTokens,
+		"temperature": params.Temperature,
 	}
 
 	openaiBody, err := json.Marshal(openaiReq)
 	if err != nil {
 		log.Printf("Failed to marshal OpenAI request: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "Failed to prepare OpenAI request"})
-		return
+		return "", "", &chatError{status: http.StatusInternalServerError, code: CodeInternal, message: "Failed to prepare OpenAI request"}
 	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
-	openaiRequest, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewReader(openaiBody))
+	completionsURL := s.Config.CompletionsURL
+	if completionsURL == "" {
+		completionsURL = openAICompletionsURL
+	}
+	openaiRequest, err := http.NewRequest("POST", completionsURL, bytes.NewReader(openaiBody))
 	if err != nil {
 		log.Printf("Failed to create OpenAI request: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "Failed to create OpenAI request"})
-		return
+		return "", "", &chatError{status: http.StatusInternalServerError, code: CodeInternal, message: "Failed to create OpenAI request"}
 	}
 	openaiRequest.Header.Set("Content-Type", "application/json")
-	openaiRequest.Header.Set("Authorization", "Bearer "+s.Config.OpenAIKey)
+	openaiRequest.Header.Set("Authorization", "Bearer "+openAIKey)
 
 	openaiResp, err := client.Do(openaiRequest)
 	if err != nil {
 		log.Printf("OpenAI API request failed: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "Failed to contact OpenAI API"})
-		return
+		return "", "", &chatError{status: http.StatusInternalServerError, code: CodeUpstreamDown, message: "Failed to contact OpenAI API"}
 	}
 	defer openaiResp.Body.Close()
 
@@ -108,57 +286,102 @@ func (s *ChatService) ChatHandler(w http.ResponseWriter, r *http.Request) {
 			errorMessage = extracted
 		}
 
-		w.Header().Set("Content-Type", "application/json")
 		if openaiResp.StatusCode == http.StatusTooManyRequests {
-			if retryAfter := openaiResp.Header.Get("Retry-After"); retryAfter != "" {
-				w.Header().Set("Retry-After", retryAfter)
-			}
-			w.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(w).Encode(ChatResponse{Error: "AI assistant is rate-limited right now. Please try again in a moment."})
-			return
+			retryAfter, _ := strconv.Atoi(openaiResp.Header.Get("Retry-After"))
+			return "", "", &chatError{status: http.StatusTooManyRequests, code: CodeUpstreamBusy, message: "AI assistant is rate-limited right now. Please try again in a moment.", retryAfter: time.Duration(retryAfter) * time.Second}
 		}
 
 		if openaiResp.StatusCode >= 500 {
-			w.WriteHeader(http.StatusBadGateway)
-			json.NewEncoder(w).Encode(ChatResponse{Error: "Upstream AI service is temporarily unavailable. Please try again."})
-			return
+			return "", "", &chatError{status: http.StatusBadGateway, code: CodeUpstreamDown, message: "Upstream AI service is temporarily unavailable. Please try again."}
 		}
 
-		w.WriteHeader(http.StatusBadGateway)
-		json.NewEncoder(w).Encode(ChatResponse{Error: errorMessage})
-		return
+		return "", "", &chatError{status: http.StatusBadGateway, code: CodeUpstreamFailed, message: errorMessage}
 	}
 
-	var openaiResult map[string]interface{}
+	var openaiResult openAIChatCompletion
 	if err := json.NewDecoder(openaiResp.Body).Decode(&openaiResult); err != nil {
 		log.Printf("Failed to decode OpenAI response: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "Failed to decode OpenAI response"})
-		return
+		return "", "", &chatError{status: http.StatusInternalServerError, code: CodeUpstreamFailed, message: "Failed to decode OpenAI response"}
 	}
 
-	var aiResponse string
-	if choices, ok := openaiResult["choices"].([]interface{}); ok && len(choices) > 0 {
-		if choice, ok := choices[0].(map[string]interface{}); ok {
-			if msg, ok := choice["message"].(map[string]interface{}); ok {
-				if content, ok := msg["content"].(string); ok {
-					aiResponse = content
-				}
-			}
-		}
+	if s.Usage != nil {
+		usage := s.Usage.Record(openaiResult.Model, openaiResult.Usage.PromptTokens, openaiResult.Usage.CompletionTokens)
+		log.Printf("OpenAI usage: model=%s prompt_tokens=%d completion_tokens=%d cost=$%.6f",
+			usage.Model, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD)
+	}
+
+	var aiResponse, finishReason string
+	if len(openaiResult.Choices) > 0 {
+		aiResponse = openaiResult.Choices[0].Message.Content
+		finishReason = openaiResult.Choices[0].FinishReason
 	}
 	if aiResponse == "" {
 		log.Printf("OpenAI response missing content")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ChatResponse{Error: "No response from OpenAI"})
-		return
+		return "", "", &chatError{status: http.StatusInternalServerError, code: CodeUpstreamFailed, message: "No response from OpenAI"}
 	}
+	return aiResponse, finishReason, nil
+}
 
-	log.Printf("OpenAI chat response sent")
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ChatResponse{Response: aiResponse})
+// checkClaims applies ClaimCheck to an answer naming companies, technologies
+// or dates the work history does not mention
+func (s *ChatService) checkClaims(openAIKey string, params ModelParams, messages []map[string]string, question, answer string) string {
+	if s.ClaimCheck == "" || s.ClaimCheck == ClaimCheckOff {
+		return answer
+	}
+	claims := CheckClaims(answer, question)
+	if len(claims) == 0 {
+		s.Metrics.Inc("chat_claim_checks_total", "Chat answers checked against the work history, by outcome.", "result", "supported")
+		return answer
+	}
+	log.Printf("Chat answer makes unsupported claims: %s (%s)", claimValues(claims), s.ClaimCheck)
+
+	switch s.ClaimCheck {
+	case ClaimCheckDisclaimer:
+		s.Metrics.Inc("chat_claim_checks_total", "Chat answers checked against the work history, by outcome.", "result", "disclaimer")
+		return withDisclaimer(answer)
+	case ClaimCheckRetry:
+		budgetSpent := false
+		if s.Usage != nil {
+			budgetSpent, _ = s.Usage.BudgetExceeded()
+		}
+		if budgetSpent {
+			s.Metrics.Inc("chat_claim_checks_total", "Chat answers checked against the work history, by outcome.", "result", "retry_skipped")
+			return removeClaims(answer, claims)
+		}
+		strict := append([]map[string]string{}, messages[:len(messages)-1]...)
+		strict = append(strict, map[string]string{"role": "system", "content": strictClaimsPrompt(claims)}, messages[len(messages)-1])
+		retried, err := s.completeAnswer(openAIKey, params, strict)
+		if err == nil {
+			remaining := CheckClaims(retried, question)
+			if len(remaining) == 0 {
+				s.Metrics.Inc("chat_claim_checks_total", "Chat answers checked against the work history, by outcome.", "result", "retried")
+				return retried
+			}
+			answer, claims = retried, remaining
+		}
+		// The retry failed or still made claims; fall back to rewriting
+		s.Metrics.Inc("chat_claim_checks_total", "Chat answers checked against the work history, by outcome.", "result", "retry_failed")
+		return removeClaims(answer, claims)
+	}
+	s.Metrics.Inc("chat_claim_checks_total", "Chat answers checked against the work history, by outcome.", "result", "rewritten")
+	return removeClaims(answer, claims)
+}
+
+// answer fills response from the model's raw answer: the text without its
+// Sources line, the sections it cites and, when enabled, follow-up suggestions
+func (s *ChatService) answer(question, raw string, response ChatResponse) ChatResponse {
+	response.Response, response.Citations = ExtractCitations(raw, WorkHistory())
+	if len(response.Citations) == 0 {
+		response.Citations = nil
+		response.Uncited = true
+		s.Metrics.Inc("chat_answers_total", "Chat answers by whether they cite the work history.", "citations", "none")
+	} else {
+		s.Metrics.Inc("chat_answers_total", "Chat answers by whether they cite the work history.", "citations", "some")
+	}
+	if s.FollowUps {
+		response.FollowUps = s.FollowUpSuggestions(question, response.Response)
+	}
+	return response
 }
 
 func extractOpenAIErrorMessage(body []byte) string {
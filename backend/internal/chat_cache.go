@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"container/list"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ChatCache serves repeated questions without calling OpenAI. Entries are
+// keyed on the normalized question and the prompt version, so a change to the
+// prompt or work history invalidates every cached answer. Within a version,
+// variants (such as A/B prompt templates) keep separate answers. A nil
+// *ChatCache is valid and caches nothing.
+type ChatCache struct {
+	// Similarity, when above 0, also serves a cached answer to a question whose
+	// content words overlap at least this much (Jaccard index, 0-1)
+	Similarity float64
+	Metrics    *Metrics
+
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	version string
+	entries map[string]*list.Element // by variant and normalized question
+	order   *list.List               // least recently used at the back
+	now     func() time.Time
+}
+
+type chatCacheEntry struct {
+	key      string
+	variant  string
+	words    map[string]bool
+	response string
+	expires  time.Time
+}
+
+// NewChatCache keeps at most maxEntries answers for ttl each
+func NewChatCache(maxEntries int, ttl time.Duration) *ChatCache {
+	return &ChatCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns the cached answer for question under the given prompt version
+func (c *ChatCache) Get(version, question string) (string, bool) {
+	return c.GetVariant(version, "", question)
+}
+
+// GetVariant is Get for answers stored under variant
+func (c *ChatCache) GetVariant(version, variant, question string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	normalized := NormalizeQuestion(question)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkVersion(version)
+
+	if element, ok := c.entries[cacheKey(variant, normalized)]; ok {
+		entry := element.Value.(*chatCacheEntry)
+		if c.now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.Metrics.Inc("chat_cache_requests_total", "Chat cache lookups by result.", "result", "hit")
+			return entry.response, true
+		}
+		c.remove(element)
+	}
+	if c.Similarity > 0 {
+		if element := c.mostSimilar(variant, contentWords(normalized)); element != nil {
+			c.order.MoveToFront(element)
+			c.Metrics.Inc("chat_cache_requests_total", "Chat cache lookups by result.", "result", "similar")
+			return element.Value.(*chatCacheEntry).response, true
+		}
+	}
+	c.Metrics.Inc("chat_cache_requests_total", "Chat cache lookups by result.", "result", "miss")
+	return "", false
+}
+
+// Put stores an answer, evicting the least recently used entry when full
+func (c *ChatCache) Put(version, question, response string) {
+	c.PutVariant(version, "", question, response)
+}
+
+// PutVariant is Put for an answer produced by variant
+func (c *ChatCache) PutVariant(version, variant, question, response string) {
+	if c == nil || c.maxEntries <= 0 {
+		return
+	}
+	normalized := NormalizeQuestion(question)
+	if normalized == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkVersion(version)
+
+	key := cacheKey(variant, normalized)
+	entry := &chatCacheEntry{key: key, variant: variant, words: contentWords(normalized), response: response, expires: c.now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.Metrics.Inc("chat_cache_evictions_total", "Chat cache entries evicted to stay under the size bound.")
+	}
+}
+
+// Flush drops every entry
+func (c *ChatCache) Flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
+
+// Len returns the number of cached answers, including expired ones not yet dropped
+func (c *ChatCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// checkVersion drops everything cached under an older prompt version
+func (c *ChatCache) checkVersion(version string) {
+	if version == c.version {
+		return
+	}
+	if c.order.Len() > 0 {
+		log.Printf("Chat prompt version changed from %s to %s, dropping %d cached answers", c.version, version, c.order.Len())
+		c.Metrics.Inc("chat_cache_invalidations_total", "Chat cache flushes caused by a prompt or work history change.")
+	}
+	c.version = version
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+}
+
+func (c *ChatCache) mostSimilar(variant string, words map[string]bool) *list.Element {
+	if len(words) == 0 {
+		return nil
+	}
+	now := c.now()
+	var best *list.Element
+	bestScore := c.Similarity
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*chatCacheEntry)
+		if entry.variant != variant || !now.Before(entry.expires) {
+			continue
+		}
+		if score := jaccard(words, entry.words); score >= bestScore {
+			best, bestScore = element, score
+		}
+	}
+	return best
+}
+
+func (c *ChatCache) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*chatCacheEntry).key)
+	c.order.Remove(element)
+}
+
+func cacheKey(variant, normalized string) string {
+	return variant + "\x00" + normalized
+}
+
+// NormalizeQuestion lowercases a question, drops punctuation and collapses
+// whitespace, so "What does Ethan do?" and "what does ethan do" match
+func NormalizeQuestion(question string) string {
+	fields := strings.FieldsFunc(strings.ToLower(question), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' && r != '#'
+	})
+	return strings.Join(fields, " ")
+}
+
+// chatStopWords carry no meaning for similarity matching
+var chatStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "about": true, "can": true, "do": true, "does": true,
+	"did": true, "for": true, "has": true, "have": true, "he": true, "his": true, "how": true, "i": true,
+	"in": true, "is": true, "me": true, "of": true, "on": true, "or": true, "tell": true, "the": true,
+	"to": true, "what": true, "which": true, "with": true, "you": true, "ethan": true, "s": true,
+}
+
+func contentWords(normalized string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.Fields(normalized) {
+		if !chatStopWords[word] {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
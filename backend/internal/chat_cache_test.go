@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChatCache(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	newCache := func(maxEntries int) *ChatCache {
+		cache := NewChatCache(maxEntries, time.Hour)
+		cache.Metrics = NewMetrics()
+		cache.now = func() time.Time { return now }
+		return cache
+	}
+
+	t.Run("normalized questions share an answer", func(t *testing.T) {
+		cache := newCache(10)
+		cache.Put("v1", "What does Ethan do?", "He is a consultant.")
+		if answer, ok := cache.Get("v1", "  what DOES ethan do "); !ok || answer != "He is a consultant." {
+			t.Errorf("Get = %q, %t", answer, ok)
+		}
+		if _, ok := cache.Get("v1", "What Go experience does he have?"); ok {
+			t.Error("unrelated question hit the cache")
+		}
+		if hits, misses := cache.Metrics.Value("chat_cache_requests_total", "result", "hit"), cache.Metrics.Value("chat_cache_requests_total", "result", "miss"); hits != 1 || misses != 1 {
+			t.Errorf("hits = %v, misses = %v", hits, misses)
+		}
+	})
+
+	t.Run("entries expire", func(t *testing.T) {
+		cache := newCache(10)
+		cache.Put("v1", "hello", "Hi!")
+		now = now.Add(2 * time.Hour)
+		if _, ok := cache.Get("v1", "hello"); ok || cache.Len() != 0 {
+			t.Errorf("expired entry served, len %d", cache.Len())
+		}
+	})
+
+	t.Run("least recently used is evicted", func(t *testing.T) {
+		cache := newCache(2)
+		cache.Put("v1", "one", "1")
+		cache.Put("v1", "two", "2")
+		cache.Get("v1", "one")
+		cache.Put("v1", "three", "3")
+		if _, ok := cache.Get("v1", "two"); ok {
+			t.Error("expected two to be evicted")
+		}
+		if _, ok := cache.Get("v1", "one"); !ok || cache.Len() != 2 {
+			t.Errorf("expected one to survive, len %d", cache.Len())
+		}
+	})
+
+	t.Run("prompt version change invalidates", func(t *testing.T) {
+		cache := newCache(10)
+		cache.Put("v1", "hello", "Hi!")
+		if _, ok := cache.Get("v2", "hello"); ok || cache.Len() != 0 {
+			t.Error("answer from an old prompt version was served")
+		}
+		if cache.Metrics.Value("chat_cache_invalidations_total") != 1 {
+			t.Error("invalidation not counted")
+		}
+	})
+
+	t.Run("similar questions", func(t *testing.T) {
+		cache := newCache(10)
+		cache.Put("v1", "What Go experience does Ethan have?", "Plenty.")
+		if _, ok := cache.Get("v1", "Tell me about Ethan's Go experience"); ok {
+			t.Error("similarity matching is off by default")
+		}
+		cache.Similarity = 0.6
+		if answer, ok := cache.Get("v1", "Tell me about Ethan's Go experience"); !ok || answer != "Plenty." {
+			t.Errorf("Get = %q, %t", answer, ok)
+		}
+		if _, ok := cache.Get("v1", "What React experience does Ethan have?"); ok {
+			t.Error("different technology matched")
+		}
+	})
+
+	t.Run("variants keep separate answers", func(t *testing.T) {
+		cache := newCache(10)
+		cache.PutVariant("v1", "default@1", "hello", "Hi!")
+		cache.PutVariant("v1", "concise@2", "hello", "Hey.")
+		if answer, ok := cache.GetVariant("v1", "concise@2", "Hello"); !ok || answer != "Hey." {
+			t.Errorf("GetVariant = %q, %t", answer, ok)
+		}
+		if _, ok := cache.GetVariant("v1", "terse@1", "hello"); ok || cache.Len() != 2 {
+			t.Error("an answer from another variant was served")
+		}
+	})
+
+	t.Run("nil cache", func(t *testing.T) {
+		var cache *ChatCache
+		cache.Put("v1", "hello", "Hi!")
+		if _, ok := cache.Get("v1", "hello"); ok {
+			t.Error("nil cache returned an answer")
+		}
+	})
+}
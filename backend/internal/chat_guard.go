@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// What ChatService does with a message that looks like a prompt injection
+const (
+	InjectionCheckOff   = "off"
+	InjectionCheckLog   = "log"   // log and count, then answer as usual
+	InjectionCheckBlock = "block" // reject with 400 message_rejected
+)
+
+// DefaultMaxMessageLength caps chat messages, in characters, when ChatService.MaxMessageLength is 0
+const DefaultMaxMessageLength = 1000
+
+// PromptLeakResponse replaces an answer that repeats the system prompt's instructions
+const PromptLeakResponse = "I can't share how I'm set up, but I'm happy to answer questions about Ethan's experience."
+
+// injectionPatterns are phrasings common in jailbreaks, matched against the
+// normalized message
+var injectionPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"ignore_instructions", regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override|bypass)\b.{0,40}\b(?:previous|prior|above|earlier|all|your|the|system)\b.{0,20}\b(?:instructions?|prompts?|rules|directions|guidelines|context)\b`)},
+	{"reveal_prompt", regexp.MustCompile(`(?i)\b(?:print|reveal|show|repeat|output|display|dump|leak|tell me|what (?:is|are|was|were)|give me)\b.{0,40}\b(?:system|initial|hidden|original|secret|pre-?)[ -]?(?:prompt|instructions?|message)s?\b`)},
+	{"role_override", regexp.MustCompile(`(?i)\byou are now\b|\bpretend (?:to be|you are)\b|\bdeveloper mode\b|\bjailbreak|\bdo anything now\b|\bfrom now on,? you\b`)},
+	{"role_markers", regexp.MustCompile(`(?im)^\s*(?:system|assistant)\s*:|<\|im_(?:start|end)\|>|\[/?INST\]|<\|system\|>`)},
+}
+
+// DetectInjection returns the name of the first injection pattern message matches
+func DetectInjection(message string) (string, bool) {
+	for _, injection := range injectionPatterns {
+		if injection.pattern.MatchString(message) {
+			return injection.name, true
+		}
+	}
+	return "", false
+}
+
+var (
+	spaceRunPattern   = regexp.MustCompile(`[ \t]+`)
+	newlineRunPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// NormalizeChatInput makes look-alike text compare equal before it is checked
+// and sent: invalid UTF-8, control and invisible formatting characters are
+// dropped, full-width letters become ASCII and runs of whitespace collapse
+func NormalizeChatInput(message string) string {
+	message = strings.ToValidUTF8(message, "")
+	message = strings.ReplaceAll(message, "\r\n", "\n")
+	message = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r >= 0xFF01 && r <= 0xFF5E:
+			return r - 0xFEE0
+		case r == 0x3000 || unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, message)
+	message = spaceRunPattern.ReplaceAllString(message, " ")
+	message = strings.ReplaceAll(message, " \n", "\n")
+	message = strings.ReplaceAll(message, "\n ", "\n")
+	message = newlineRunPattern.ReplaceAllString(message, "\n\n")
+	return strings.TrimSpace(message)
+}
+
+// Moderator flags abusive chat messages before they reach the model
+type Moderator interface {
+	// Moderate returns the categories message is flagged for; none means it
+	// may be answered. It gives up when ctx is cancelled.
+	Moderate(ctx context.Context, message string) ([]string, error)
+}
+
+const openAIModerationsURL = "https://api.openai.com/v1/moderations"
+
+// OpenAIModerator checks messages with the OpenAI moderation endpoint
+type OpenAIModerator struct {
+	// URL overrides the OpenAI endpoint (used by tests)
+	URL string
+
+	apiKey func() string
+	client *http.Client
+}
+
+// NewOpenAIModerator creates a moderator that reads its OpenAI key from apiKey
+// on every call, so a rotated key is picked up without a restart
+func NewOpenAIModerator(apiKey func() string) *OpenAIModerator {
+	return &OpenAIModerator{apiKey: apiKey, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (m *OpenAIModerator) Moderate(ctx context.Context, message string) ([]string, error) {
+	openAIKey := m.apiKey()
+	if openAIKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not configured")
+	}
+	url := m.URL
+	if url == "" {
+		url = openAIModerationsURL
+	}
+	body, err := json.Marshal(map[string]string{"input": message})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+openAIKey)
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation returned status %d", response.StatusCode)
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	var categories []string
+	for _, moderation := range result.Results {
+		for category, flagged := range moderation.Categories {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+		if moderation.Flagged && len(categories) == 0 {
+			categories = append(categories, "flagged")
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+// screenMessage runs a chat message through the input pipeline: it is
+// normalized, capped in length, checked for injection phrasings and, with a
+// Moderator, moderated. It returns the message to answer, or why it was rejected.
+func (s *ChatService) screenMessage(ctx context.Context, message string) (string, *chatError) {
+	message = NormalizeChatInput(message)
+	if message == "" {
+		s.countInput("empty")
+		return "", &chatError{status: http.StatusBadRequest, code: CodeInvalidRequest, message: "message is required"}
+	}
+
+	maxLength := s.MaxMessageLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxMessageLength
+	}
+	if length := utf8.RuneCountInString(message); length > maxLength {
+		log.Printf("Chat message rejected: %d characters, limit %d", length, maxLength)
+		s.countInput("too_long")
+		return "", &chatError{status: http.StatusBadRequest, code: CodeMessageTooLong, message: fmt.Sprintf("Message is too long; keep it under %d characters.", maxLength)}
+	}
+
+	if s.InjectionCheck != "" && s.InjectionCheck != InjectionCheckOff {
+		if pattern, found := DetectInjection(message); found {
+			log.Printf("Chat message matches injection pattern %s (%s)", pattern, s.InjectionCheck)
+			s.countInput("injection")
+			s.Metrics.Inc("chat_injection_patterns_total", "Chat messages matching prompt injection patterns, by pattern.", "pattern", pattern)
+			if s.InjectionCheck == InjectionCheckBlock {
+				return "", &chatError{status: http.StatusBadRequest, code: CodeMessageRejected, message: "This message can't be answered. Please ask about Ethan's experience."}
+			}
+		}
+	}
+
+	if s.Moderator != nil {
+		categories, err := s.Moderator.Moderate(ctx, message)
+		switch {
+		case err != nil:
+			// Moderation is a second line of defence; answer rather than fail when it is down
+			log.Printf("Chat moderation failed, answering unmoderated: %v", err)
+			s.countInput("moderation_error")
+		case len(categories) > 0:
+			log.Printf("Chat message flagged by moderation: %s", strings.Join(categories, ", "))
+			s.countInput("flagged")
+			return "", &chatError{status: http.StatusBadRequest, code: CodeMessageRejected, message: "This message can't be answered. Please ask about Ethan's experience."}
+		}
+	}
+
+	s.countInput("accepted")
+	return message, nil
+}
+
+func (s *ChatService) countInput(result string) {
+	s.Metrics.Inc("chat_input_checks_total", "Chat messages by input pipeline outcome.", "result", result)
+}
+
+// promptLeakShingleWords is how many consecutive words of the instructions an
+// answer must repeat to count as leaking them
+const promptLeakShingleWords = 8
+
+var (
+	leakWordPattern = regexp.MustCompile(`[a-z0-9']+`)
+
+	// preambleShingles are the word runs of the instructions above the first
+	// work history heading; the work history itself may be shared
+	preambleShingles = sync.OnceValue(func() map[string]bool {
+		preamble, _, _ := strings.Cut(WorkHistoryPrompt, "\n#")
+		return shingles(preamble)
+	})
+)
+
+func shingles(text string) map[string]bool {
+	words := leakWordPattern.FindAllString(strings.ToLower(text), -1)
+	set := map[string]bool{}
+	for i := 0; i+promptLeakShingleWords <= len(words); i++ {
+		set[strings.Join(words[i:i+promptLeakShingleWords], " ")] = true
+	}
+	return set
+}
+
+// DetectPromptLeak reports whether answer repeats the default prompt
+// template's instructions or the section ID tags it adds to the work history
+func DetectPromptLeak(answer string) bool {
+	return detectPromptLeak(answer, defaultPromptTemplates().active[0].instructions)
+}
+
+func detectPromptLeak(answer string, instructions map[string]bool) bool {
+	// Sources lines may cite sections as "[id: ...]", see ExtractCitations
+	if strings.Contains(sourcesLinePattern.ReplaceAllString(answer, ""), "[id: ") {
+		return true
+	}
+	preamble := preambleShingles()
+	for shingle := range shingles(answer) {
+		if instructions[shingle] || preamble[shingle] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPromptLeak replaces an answer that leaks the instructions of its prompt template
+func (s *ChatService) checkPromptLeak(prompt *activePrompt, answer string) string {
+	if !detectPromptLeak(answer, prompt.instructions) {
+		return answer
+	}
+	log.Printf("Chat answer repeats the system prompt %s, replaced", prompt.ID())
+	s.Metrics.Inc("chat_prompt_leaks_total", "Chat answers replaced because they repeated the system prompt.")
+	return PromptLeakResponse
+}
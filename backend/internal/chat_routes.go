@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// How an answer cut off at max_tokens (finish_reason "length") is handled
+const (
+	TruncationContinue = "continue" // ask the model to carry on, up to MaxContinuations times, then trim
+	TruncationTrim     = "trim"     // cut back to the last complete sentence
+)
+
+// ModelParams are the completion settings for a chat request
+type ModelParams struct {
+	Model            string
+	MaxTokens        int
+	Temperature      float64
+	Truncation       string
+	MaxContinuations int
+}
+
+// DefaultModelParams are used for questions no route matches
+var DefaultModelParams = ModelParams{
+	Model:            "gpt-3.5-turbo",
+	MaxTokens:        300,
+	Temperature:      0.7,
+	Truncation:       TruncationContinue,
+	MaxContinuations: 1,
+}
+
+// ChatRoute sends matching questions to other model parameters. Every match
+// condition that is set must hold; override fields left empty keep the defaults.
+type ChatRoute struct {
+	Name string `yaml:"name"`
+
+	// MinWords and MaxWords bound the length of the question in words
+	MinWords int `yaml:"min_words"`
+	MaxWords int `yaml:"max_words"`
+	// Technical, when set, requires the question to be (or not be) about
+	// technology, see IsTechnicalQuestion
+	Technical *bool `yaml:"technical"`
+	// Keywords match when the question contains any of them, case-insensitively
+	Keywords []string `yaml:"keywords"`
+
+	Model            string   `yaml:"model"`
+	MaxTokens        int      `yaml:"max_tokens"`
+	Temperature      *float64 `yaml:"temperature"`
+	Truncation       string   `yaml:"truncation"`
+	MaxContinuations *int     `yaml:"max_continuations"`
+}
+
+// technicalTerms mark a question as technical alongside KnownTechnologies,
+// matched as lowercase word prefixes
+var technicalTerms = regexp.MustCompile(`\b(?:architect|design|api|backend|frontend|database|concurren|scal|performan|latency|test|deploy|infrastructure|cloud|microservice|pipeline|etl|language|framework|stack|code|coding|programming|engineer|technical|technolog|system|resilien|failover|tokeniz)`)
+
+// IsTechnicalQuestion reports whether a question names a known technology or
+// asks about engineering topics such as architecture, scaling or testing
+func IsTechnicalQuestion(question string) bool {
+	return len(MentionedTechnologies(question)) > 0 || technicalTerms.MatchString(strings.ToLower(question))
+}
+
+func (r ChatRoute) matches(question string) bool {
+	words := len(strings.Fields(question))
+	if r.MinWords > 0 && words < r.MinWords {
+		return false
+	}
+	if r.MaxWords > 0 && words > r.MaxWords {
+		return false
+	}
+	if r.Technical != nil && IsTechnicalQuestion(question) != *r.Technical {
+		return false
+	}
+	if len(r.Keywords) > 0 {
+		lower := strings.ToLower(question)
+		found := false
+		for _, keyword := range r.Keywords {
+			if strings.Contains(lower, strings.ToLower(keyword)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns params with the route's overrides
+func (r ChatRoute) apply(params ModelParams) ModelParams {
+	if r.Model != "" {
+		params.Model = r.Model
+	}
+	if r.MaxTokens > 0 {
+		params.MaxTokens = r.MaxTokens
+	}
+	if r.Temperature != nil {
+		params.Temperature = *r.Temperature
+	}
+	if r.Truncation != "" {
+		params.Truncation = r.Truncation
+	}
+	if r.MaxContinuations != nil {
+		params.MaxContinuations = *r.MaxContinuations
+	}
+	return params
+}
+
+// route picks the first route matching question and returns its name and
+// parameters, or "default" and s.Model
+func (s *ChatService) route(question string) (string, ModelParams) {
+	params := s.Model
+	if params.Model == "" {
+		params = DefaultModelParams
+	}
+	for _, route := range s.Routes {
+		if route.matches(question) {
+			return route.Name, route.apply(params)
+		}
+	}
+	return "default", params
+}
+
+// continuePrompt asks the model to finish an answer cut off at max_tokens
+const continuePrompt = "Continue your previous answer exactly where it stopped, without repeating anything."
+
+// completeAnswer is complete, handling answers cut off at max_tokens as
+// params.Truncation says
+func (s *ChatService) completeAnswer(openAIKey string, params ModelParams, messages []map[string]string) (string, *chatError) {
+	answer, finishReason, err := s.complete(openAIKey, params, messages)
+	if err != nil {
+		return "", err
+	}
+	for continuations := 0; finishReason == "length"; continuations++ {
+		if params.Truncation == TruncationContinue && continuations < params.MaxContinuations {
+			more := append(append([]map[string]string{}, messages...),
+				map[string]string{"role": "assistant", "content": answer},
+				map[string]string{"role": "user", "content": continuePrompt})
+			next, nextReason, err := s.complete(openAIKey, params, more)
+			if err == nil {
+				s.Metrics.Inc("chat_truncations_total", "Chat answers cut off at max_tokens, by how they were handled.", "action", "continued")
+				answer, finishReason = joinContinuation(answer, next), nextReason
+				continue
+			}
+			// Keep what was already answered rather than failing the request
+			log.Printf("Chat answer continuation failed, trimming: %v", err)
+		}
+		log.Printf("Chat answer from %s hit max_tokens %d, trimmed to the last sentence", params.Model, params.MaxTokens)
+		s.Metrics.Inc("chat_truncations_total", "Chat answers cut off at max_tokens, by how they were handled.", "action", "trimmed")
+		return TrimToSentence(answer), nil
+	}
+	return answer, nil
+}
+
+// joinContinuation appends a continuation, which picks up mid-word or
+// mid-sentence, adding a space only after a finished sentence
+func joinContinuation(answer, next string) string {
+	if strings.HasSuffix(answer, ".") || strings.HasSuffix(answer, "!") || strings.HasSuffix(answer, "?") {
+		if next != "" && !strings.HasPrefix(next, " ") && !strings.HasPrefix(next, "\n") {
+			return answer + " " + next
+		}
+	}
+	return answer + next
+}
+
+// TrimToSentence cuts text back to its last complete sentence or line. Text
+// without one ends with an ellipsis instead.
+func TrimToSentence(text string) string {
+	text = strings.TrimRight(text, " \t")
+	if end := strings.LastIndexAny(text, ".!?\n"); end > 0 {
+		return strings.TrimSpace(text[:end+1])
+	}
+	return strings.TrimSpace(text) + "…"
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChatRouting(t *testing.T) {
+	zero, yes, no := 0.0, true, false
+	service := NewChatService("sk-test")
+	if _, params := service.route("How did Ethan design the buffer feature and what did it do for account creation latency?"); params != DefaultModelParams {
+		t.Errorf("without routes every question should use the defaults: %+v", params)
+	}
+
+	service.Routes = []ChatRoute{
+		{Name: "hiring", Keywords: []string{"hire"}, Model: "gpt-4o", Temperature: &zero},
+		{Name: "small_talk", MaxWords: 6, Technical: &no, Model: "gpt-4o-mini", MaxTokens: 100},
+		{Name: "technical", MinWords: 12, Technical: &yes, Model: "gpt-4o", MaxTokens: 500},
+	}
+
+	tests := []struct {
+		question string
+		route    string
+		model    string
+	}{
+		{"Hi there!", "small_talk", "gpt-4o-mini"},
+		{"What Go?", "default", "gpt-3.5-turbo"},
+		{"How did Ethan design the buffer feature and what did it do for account creation latency?", "technical", "gpt-4o"},
+		{"Why should we hire Ethan?", "hiring", "gpt-4o"},
+		{"Tell me about Ethan's time with the consulting firm and his clients", "default", "gpt-3.5-turbo"},
+	}
+	for _, tt := range tests {
+		route, params := service.route(tt.question)
+		if route != tt.route || params.Model != tt.model {
+			t.Errorf("route(%q) = %s %s, want %s %s", tt.question, route, params.Model, tt.route, tt.model)
+		}
+	}
+
+	if _, params := service.route("Why hire him?"); params.Temperature != 0 || params.MaxTokens != DefaultModelParams.MaxTokens {
+		t.Errorf("overrides not applied over the defaults: %+v", params)
+	}
+}
+
+func TestTrimToSentence(t *testing.T) {
+	for text, want := range map[string]string{
+		"Ethan builds Go services. He also led the migra": "Ethan builds Go services.",
+		"Highlights:\n- Go services\n- AWS Step Fun":      "Highlights:\n- Go services",
+		"Ethan builds Go services and":                    "Ethan builds Go services and…",
+	} {
+		if got := TrimToSentence(text); got != want {
+			t.Errorf("TrimToSentence(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestChatHandlerHandlesTruncation(t *testing.T) {
+	type reply struct{ content, finishReason string }
+	var replies []reply
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+		next := replies[0]
+		replies = replies[1:]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model":   body["model"],
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": next.content}, "finish_reason": next.finishReason}},
+		})
+	}))
+	defer server.Close()
+
+	service := NewChatService("sk-test")
+	service.Config.CompletionsURL = server.URL
+	service.Model = ModelParams{Model: "gpt-4o-mini", MaxTokens: 50, Temperature: 0.2, Truncation: TruncationContinue, MaxContinuations: 1}
+
+	replies = []reply{{"Ethan led the dry-run sys", "length"}, {"tem for the migration.", "stop"}}
+	if _, response := postChat(t, service, "What did Ethan build?"); response.Response != "Ethan led the dry-run system for the migration." {
+		t.Errorf("continued response = %q", response.Response)
+	}
+	if len(requests) != 2 || requests[0]["model"] != "gpt-4o-mini" || requests[0]["max_tokens"] != 50.0 || requests[0]["temperature"] != 0.2 {
+		t.Fatalf("requests = %+v", requests)
+	}
+	if messages := requests[1]["messages"].([]interface{}); len(messages) != 4 || messages[2].(map[string]interface{})["role"] != "assistant" {
+		t.Errorf("continuation messages = %+v", messages)
+	}
+
+	requests = nil
+	service.Model.Truncation = TruncationTrim
+	replies = []reply{{"Ethan writes Go. He also wrote the buff", "length"}}
+	if _, response := postChat(t, service, "What does Ethan write?"); response.Response != "Ethan writes Go." || len(requests) != 1 {
+		t.Errorf("trimmed response = %q after %d requests", response.Response, len(requests))
+	}
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFakeOpenAI(t *testing.T, calls *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"model": "gpt-3.5-turbo-0125",
+			"choices": [{"message": {"role": "assistant", "content": "Ethan is a Senior Consultant."}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 1000, "completion_tokens": 500, "total_tokens": 1500}
+		}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postChat(t *testing.T, service *ChatService, message string) (*httptest.ResponseRecorder, ChatResponse) {
+	t.Helper()
+	body, _ := json.Marshal(ChatRequest{Message: message})
+	rr := httptest.NewRecorder()
+	service.ChatHandler(rr, httptest.NewRequest("POST", "/api/chat", bytes.NewReader(body)))
+
+	var response ChatResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not parse response %q: %v", rr.Body.String(), err)
+	}
+	return rr, response
+}
+
+func TestChatHandlerRecordsUsageAndEnforcesBudget(t *testing.T) {
+	calls := 0
+	server := newFakeOpenAI(t, &calls)
+
+	usagePath := filepath.Join(t.TempDir(), "usage.json")
+	tracker, err := NewUsageTracker(usagePath, nil, 0.001, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewChatService("sk-test")
+	service.Config.CompletionsURL = server.URL
+	service.Usage = tracker
+
+	rr, response := postChat(t, service, "What does Ethan do?")
+	if rr.Code != http.StatusOK || response.Response == "" || response.Fallback {
+		t.Fatalf("unexpected first response: %d %+v", rr.Code, response)
+	}
+
+	report := tracker.Report()
+	if report.Today.PromptTokens != 1000 || report.Today.CompletionTokens != 500 {
+		t.Errorf("unexpected token totals: %+v", report.Today)
+	}
+	// Dated snapshot priced as gpt-3.5-turbo: 1000*0.0005/1000 + 500*0.0015/1000
+	if want := 0.00125; report.Today.CostUSD < want-1e-9 || report.Today.CostUSD > want+1e-9 {
+		t.Errorf("cost = %v, want %v", report.Today.CostUSD, want)
+	}
+	if !report.FallbackActive {
+		t.Error("expected daily budget to be exhausted")
+	}
+
+	_, response = postChat(t, service, "What does Ethan do?")
+	if !response.Fallback || response.Response != FallbackResponse {
+		t.Errorf("expected fallback response, got %+v", response)
+	}
+	if calls != 1 {
+		t.Errorf("OpenAI called %d times, want 1", calls)
+	}
+
+	reloaded, err := NewUsageTracker(usagePath, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Report().Month.Requests != 1 {
+		t.Errorf("expected persisted monthly totals, got %+v", reloaded.Report().Month)
+	}
+}
+
+func TestParseModelPrices(t *testing.T) {
+	prices, err := ParseModelPrices("gpt-4o=0.0025:0.01, gpt-4o-mini=0.00015:0.0006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prices["gpt-4o-mini"].CompletionPer1K != 0.0006 || len(prices) != 2 {
+		t.Errorf("unexpected prices: %+v", prices)
+	}
+
+	if _, err := ParseModelPrices("gpt-4o=cheap"); err == nil {
+		t.Error("expected an error for a malformed entry")
+	}
+}
+
+func TestChatHandlerUsesRotatedKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"gpt-3.5-turbo","choices":[{"message":{"content":"Hi"},"finish_reason":"stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	file, err := NewFileSecretStore(filepath.Join(t.TempDir(), "secrets.json"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewChatService("")
+	service.Config.CompletionsURL = server.URL
+	service.Secrets = SecretStores{file, NewEnvSecretStore(map[string]string{"openai": "sk-env"})}
+
+	postChat(t, service, "Hello")
+	file.Put("openai", "sk-rotated", 0)
+	postChat(t, service, "Hello again")
+
+	if len(keys) != 2 || keys[0] != "Bearer sk-env" || keys[1] != "Bearer sk-rotated" {
+		t.Errorf("keys sent = %v", keys)
+	}
+}
+
+func TestChatHandlerCachesAnswers(t *testing.T) {
+	calls := 0
+	server := newFakeOpenAI(t, &calls)
+
+	service := NewChatService("sk-test")
+	service.Config.CompletionsURL = server.URL
+	service.Cache = NewChatCache(10, time.Hour)
+
+	if _, response := postChat(t, service, "What does Ethan do?"); response.Cached {
+		t.Error("first answer marked as cached")
+	}
+	_, response := postChat(t, service, "what does ethan do")
+	if !response.Cached || response.Response != "Ethan is a Senior Consultant." {
+		t.Errorf("second answer = %+v", response)
+	}
+	if calls != 1 {
+		t.Errorf("OpenAI called %d times, want 1", calls)
+	}
+}
+
+func TestChatHandlerCitesSections(t *testing.T) {
+	content := "Ethan led the Account Migration.\nSources: account-migration"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model":   "gpt-3.5-turbo",
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}, "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	service := NewChatService("sk-test")
+	service.Config.CompletionsURL = server.URL
+	service.Metrics = NewMetrics()
+
+	_, response := postChat(t, service, "What did Ethan migrate?")
+	if response.Response != "Ethan led the Account Migration." || response.Uncited {
+		t.Errorf("response = %+v", response)
+	}
+	if len(response.Citations) != 1 || response.Citations[0] != (Citation{SectionID: "account-migration", Title: "Account Migration"}) {
+		t.Errorf("citations = %+v", response.Citations)
+	}
+
+	content = "Hi! Ask me about Ethan's work.\nSources: none"
+	if _, response := postChat(t, service, "hello"); !response.Uncited || response.Citations != nil {
+		t.Errorf("uncited response = %+v", response)
+	}
+	if service.Metrics.Value("chat_answers_total", "citations", "none") != 1 {
+		t.Error("uncited answer not counted")
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Citation points an answer at the work history section it drew on
+type Citation struct {
+	SectionID string `json:"section_id"`
+	Title     string `json:"title"`
+}
+
+// citationInstructions ask the model to end every answer with its sources
+const citationInstructions = "Each section of the work history is tagged [id: ...]. End every answer with a final line \"Sources: \" followed by the comma-separated ids of the sections you used, or \"Sources: none\" if you used none. Do not mention the ids anywhere else."
+
+var sourcesLinePattern = regexp.MustCompile(`(?im)^[ \t*_]*sources?[ \t*_]*:(.*)$`)
+
+// AnnotatedWorkHistory is WorkHistoryPrompt with every heading tagged with
+// its section ID, so the model can cite sections
+var AnnotatedWorkHistory = sync.OnceValue(func() string {
+	return annotateWorkHistory(WorkHistoryPrompt, WorkHistory())
+})
+
+// annotateWorkHistory tags headings in order with the IDs ParseWorkHistory gave them
+func annotateWorkHistory(markdown string, sections []WorkSection) string {
+	lines := strings.Split(markdown, "\n")
+	next := 0
+	for i, line := range lines {
+		if next < len(sections) && headingPattern.MatchString(line) {
+			lines[i] = strings.TrimRight(line, " ") + " [id: " + sections[next].ID + "]"
+			next++
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ExtractCitations removes the "Sources:" line from an answer and returns the
+// cleaned answer with the sections it names. Unknown IDs are dropped. Without
+// a Sources line, sections whose titles the answer mentions are cited instead.
+func ExtractCitations(answer string, sections []WorkSection) (string, []Citation) {
+	byID := map[string]WorkSection{}
+	for _, section := range sections {
+		byID[section.ID] = section
+	}
+
+	citations := []Citation{}
+	add := func(section WorkSection) {
+		for _, citation := range citations {
+			if citation.SectionID == section.ID {
+				return
+			}
+		}
+		citations = append(citations, Citation{SectionID: section.ID, Title: section.Title})
+	}
+
+	matches := sourcesLinePattern.FindAllStringSubmatchIndex(answer, -1)
+	if len(matches) == 0 {
+		lower := strings.ToLower(answer)
+		for _, section := range sections {
+			if strings.Contains(lower, strings.ToLower(section.Title)) {
+				add(section)
+			}
+		}
+		return strings.TrimSpace(answer), citations
+	}
+
+	last := matches[len(matches)-1]
+	sources := answer[last[2]:last[3]]
+	for _, id := range strings.FieldsFunc(sources, func(r rune) bool { return r == ',' || r == ' ' || r == ';' }) {
+		id = strings.Trim(id, "[]`*_.\"'")
+		id = strings.TrimPrefix(id, "id:")
+		if section, ok := byID[id]; ok {
+			add(section)
+		}
+	}
+	return strings.TrimSpace(answer[:last[0]] + answer[last[1]:]), citations
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnnotateWorkHistory(t *testing.T) {
+	annotated := annotateWorkHistory(sampleWorkHistory, ParseWorkHistory(sampleWorkHistory))
+	for _, heading := range []string{
+		"### Engineer at Acme [id: engineer-at-acme]",
+		"#### Billing Rewrite [id: billing-rewrite]",
+		"## Mentoring Program [id: mentoring-program]",
+	} {
+		if !strings.Contains(annotated, heading+"\n") {
+			t.Errorf("missing %q in:\n%s", heading, annotated)
+		}
+	}
+	prompt, err := defaultPromptTemplates().assign("").render("", "en", time.Now())
+	if err != nil || !strings.Contains(prompt, "[id: core-banking-platform-development]") {
+		t.Error("system prompt does not tag the work history with section IDs")
+	}
+}
+
+func TestExtractCitations(t *testing.T) {
+	sections := ParseWorkHistory(sampleWorkHistory)
+	tests := []struct {
+		name      string
+		answer    string
+		want      string
+		citations []Citation
+	}{
+		{
+			name:   "sources line",
+			answer: "Ethan rewrote billing in Go.\n\nSources: billing-rewrite, engineer-at-acme",
+			want:   "Ethan rewrote billing in Go.",
+			citations: []Citation{
+				{SectionID: "billing-rewrite", Title: "Billing Rewrite"},
+				{SectionID: "engineer-at-acme", Title: "Engineer at Acme"},
+			},
+		},
+		{
+			name:      "unknown and repeated ids are dropped",
+			answer:    "He built search.\n**Sources:** [search], made-up-job, search",
+			want:      "He built search.",
+			citations: []Citation{{SectionID: "search", Title: "Search"}},
+		},
+		{
+			name:      "sources none",
+			answer:    "Hello there!\nSources: none",
+			want:      "Hello there!",
+			citations: []Citation{},
+		},
+		{
+			name:      "titles without a sources line",
+			answer:    "He ran the Mentoring Program.",
+			want:      "He ran the Mentoring Program.",
+			citations: []Citation{{SectionID: "mentoring-program", Title: "Mentoring Program"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, citations := ExtractCitations(tt.answer, sections)
+			if answer != tt.want {
+				t.Errorf("answer = %q, want %q", answer, tt.want)
+			}
+			if !reflect.DeepEqual(citations, tt.citations) {
+				t.Errorf("citations = %+v, want %+v", citations, tt.citations)
+			}
+		})
+	}
+}
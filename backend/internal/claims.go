@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// What ChatService does with an answer that makes claims the work history
+// does not support
+const (
+	ClaimCheckOff        = "off"
+	ClaimCheckDisclaimer = "disclaimer" // append ClaimDisclaimer
+	ClaimCheckRewrite    = "rewrite"    // drop the sentences making the claims
+	ClaimCheckRetry      = "retry"      // ask again with a stricter prompt, then rewrite
+)
+
+// ClaimDisclaimer is appended to answers with unsupported claims
+const ClaimDisclaimer = "Note: parts of this answer could not be verified against Ethan's work history. Please check his resume or reach out to him on LinkedIn to confirm."
+
+// ClaimFallbackResponse replaces an answer when rewriting leaves nothing of it
+const ClaimFallbackResponse = "I can only speak to what is in Ethan's work history, and it doesn't cover that. Feel free to ask about his roles, projects or the technologies he has used."
+
+// UnsupportedClaim is an entity named in an answer that the work history does not mention
+type UnsupportedClaim struct {
+	// Kind is company, technology or date
+	Kind  string
+	Value string
+}
+
+// claimAllowlist are names an answer may use that are not employers or clients
+var claimAllowlist = []string{"Ethan", "Ethan Merrill", "LinkedIn"}
+
+// ambiguousAliases are technology spellings that are also everyday words.
+// Opening a sentence, where any word is capitalized, they are not claims.
+var ambiguousAliases = map[string]bool{
+	"Go": true, "Rails": true, "Excel": true, "Rust": true, "Glue": true, "Behave": true,
+	"Jest": true, "React": true, "Aurora": true, "Lambda": true,
+}
+
+// claimLeadWords start capitalized phrases that are not names
+var claimLeadWords = map[string]bool{
+	"A": true, "An": true, "The": true, "His": true, "Her": true, "Their": true, "This": true, "That": true,
+	"These": true, "Those": true, "Each": true, "Every": true, "Both": true, "All": true, "Many": true, "Some": true,
+}
+
+var (
+	// companyPattern finds capitalized names following words that usually introduce an organisation
+	companyPattern = regexp.MustCompile(`\b(?:at|for|with|joined|by|from)\s+([A-Z][\w&'-]*(?:\.[\w&'-]+)*(?:[ \t]+(?:[A-Z][\w&'-]*(?:\.[\w&'-]+)*|of|&))*)`)
+	yearPattern    = regexp.MustCompile(`\b(?:19|20)\d{2}\b`)
+	// deniedPattern marks a sentence as negated or hedged
+	deniedPattern = regexp.MustCompile(`(?i)\b(?:no|not|never|none|neither|nor|without|unsure|unclear|unknown|uncertain)\b|n't\b`)
+
+	// workHistoryFacts is what the work history supports: its technologies,
+	// years and text
+	workHistoryFacts = sync.OnceValue(func() claimFacts {
+		return newClaimFacts(WorkHistory(), WorkHistoryPrompt)
+	})
+)
+
+type claimFacts struct {
+	technologies map[string]bool
+	years        map[string]bool
+	text         string
+}
+
+func newClaimFacts(sections []WorkSection, markdown string) claimFacts {
+	// Without emphasis markers, so "_March 2024_" still has the word March
+	text := strings.NewReplacer("_", " ", "*", " ").Replace(markdown)
+	facts := claimFacts{technologies: map[string]bool{}, years: map[string]bool{}, text: text}
+	for _, section := range sections {
+		for _, tech := range section.Technologies {
+			facts.technologies[tech] = true
+		}
+	}
+	for _, year := range yearPattern.FindAllString(markdown, -1) {
+		facts.years[year] = true
+	}
+	return facts
+}
+
+// CheckClaims returns the companies, technologies and years named in answer
+// that the work history does not mention. An entity the question names is not
+// a claim when every sentence mentioning it is negated or hedged, so "Did
+// Ethan use Rust?" may be answered with "No, not Rust" but not "Yes, Rust".
+func CheckClaims(answer, question string) []UnsupportedClaim {
+	return workHistoryFacts().check(answer, question)
+}
+
+func (f claimFacts) check(answer, question string) []UnsupportedClaim {
+	var claims []UnsupportedClaim
+	seen := map[string]bool{}
+	add := func(kind, value string) {
+		if !seen[value] {
+			seen[value] = true
+			claims = append(claims, UnsupportedClaim{Kind: kind, Value: value})
+		}
+	}
+
+	asked := MentionedTechnologies(question)
+	for _, tech := range claimedTechnologies(answer) {
+		denied := contains(asked, tech) && onlyDenied(answer, func(sentence string) bool {
+			return contains(claimedTechnologies(sentence), tech)
+		})
+		if !f.technologies[tech] && !denied {
+			add("technology", tech)
+		}
+	}
+
+	lowerQuestion := strings.ToLower(question)
+	for _, match := range companyPattern.FindAllStringSubmatch(answer, -1) {
+		name := strings.TrimRight(match[1], "'&- ")
+		name = strings.TrimSuffix(strings.TrimSuffix(name, " of"), " &")
+		name = strings.TrimSuffix(name, "'s")
+		if name == "" || claimLeadWords[strings.Fields(name)[0]] || contains(claimAllowlist, name) || len(MentionedTechnologies(name)) > 0 {
+			continue
+		}
+		denied := strings.Contains(lowerQuestion, strings.ToLower(name)) && onlyDenied(answer, func(sentence string) bool {
+			return containsWord(sentence, name)
+		})
+		// Whole words, so "Intel" is not supported by "Intelligence"
+		if !containsWord(f.text, name) && !denied {
+			add("company", name)
+		}
+	}
+
+	for _, year := range yearPattern.FindAllString(answer, -1) {
+		denied := strings.Contains(question, year) && onlyDenied(answer, func(sentence string) bool {
+			return strings.Contains(sentence, year)
+		})
+		if !f.years[year] && !denied {
+			add("date", year)
+		}
+	}
+	return claims
+}
+
+// onlyDenied reports whether every sentence of answer that mentions an entity
+// is negated or hedged
+func onlyDenied(answer string, mentions func(sentence string) bool) bool {
+	found := false
+	for _, sentence := range splitSentences(answer) {
+		if !mentions(sentence) {
+			continue
+		}
+		if !deniedPattern.MatchString(sentence) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// claimedTechnologies is MentionedTechnologies without ambiguous aliases
+// that open a sentence, so "Go ahead" or "Excel at it" claim nothing
+func claimedTechnologies(text string) []string {
+	var b strings.Builder
+	for _, sentence := range splitSentences(text) {
+		body := strings.TrimLeft(sentence, " \t\n-*>\"'(")
+		first := strings.FieldsFunc(body, func(r rune) bool { return !unicode.IsLetter(r) })
+		if len(first) > 0 && strings.HasPrefix(body, first[0]) && ambiguousAliases[first[0]] {
+			sentence = sentence[:len(sentence)-len(body)] + body[len(first[0]):]
+		}
+		b.WriteString(sentence)
+	}
+	return MentionedTechnologies(b.String())
+}
+
+// containsWord reports whether text has word as a whole, case-sensitive word
+func containsWord(text, word string) bool {
+	return regexp.MustCompile(`(?:^|[^\w.#])` + regexp.QuoteMeta(word) + `(?:$|[^\w#])`).MatchString(text)
+}
+
+// claimValues lists the values of claims for logs and prompts
+func claimValues(claims []UnsupportedClaim) string {
+	values := make([]string, len(claims))
+	for i, claim := range claims {
+		values[i] = claim.Value
+	}
+	return strings.Join(values, ", ")
+}
+
+// strictClaimsPrompt is added to the system prompt when retrying an answer
+// that made unsupported claims
+func strictClaimsPrompt(claims []UnsupportedClaim) string {
+	return "Your previous answer mentioned " + claimValues(claims) + ", which the work history does not. Answer again using only facts stated in the work history. Do not name any employer, client, technology or date it does not mention; if it does not say, say that you don't know."
+}
+
+// withDisclaimer appends ClaimDisclaimer to an answer, ahead of its Sources line
+func withDisclaimer(answer string) string {
+	if loc := sourcesLinePattern.FindStringIndex(answer); loc != nil {
+		return strings.TrimRight(answer[:loc[0]], "\n ") + "\n\n" + ClaimDisclaimer + "\n" + answer[loc[0]:]
+	}
+	return strings.TrimRight(answer, "\n ") + "\n\n" + ClaimDisclaimer
+}
+
+// removeClaims drops the sentences of an answer that make any of claims. The
+// Sources line is kept; if nothing else is left, ClaimFallbackResponse is used.
+func removeClaims(answer string, claims []UnsupportedClaim) string {
+	var kept []string
+	remaining := false
+	for _, sentence := range splitSentences(answer) {
+		if sourcesLinePattern.MatchString(strings.TrimSpace(sentence)) {
+			kept = append(kept, sentence)
+			continue
+		}
+		makesClaim := false
+		for _, claim := range claims {
+			if containsWord(sentence, claim.Value) || (claim.Kind == "technology" && contains(claimedTechnologies(sentence), claim.Value)) {
+				makesClaim = true
+				break
+			}
+		}
+		if !makesClaim {
+			kept = append(kept, sentence)
+			remaining = remaining || strings.TrimSpace(sentence) != ""
+		}
+	}
+	if !remaining {
+		return ClaimFallbackResponse
+	}
+	return strings.TrimSpace(strings.Join(kept, ""))
+}
+
+// splitSentences splits text after sentence-ending punctuation followed by
+// whitespace, and after newlines. Joining the parts gives back text.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		end := -1
+		switch {
+		case text[i] == '\n':
+			end = i + 1
+		case strings.ContainsRune(".!?", rune(text[i])) && i+1 < len(text) && (text[i+1] == ' ' || text[i+1] == '\t'):
+			end = i + 2
+		}
+		if end > 0 {
+			sentences = append(sentences, text[start:end])
+			start, i = end, end-1
+		}
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
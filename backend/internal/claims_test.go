@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckClaims(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		question string
+		want     []UnsupportedClaim
+	}{
+		{
+			name:   "supported",
+			answer: "At CapTech, Ethan built services in GoLang on AWS Lambdas for a top 3 credit card company from March 2024.",
+		},
+		{
+			name:   "invented employer, technology and year",
+			answer: "Ethan worked at Capital One in 2019, running Kubernetes clusters.",
+			want: []UnsupportedClaim{
+				{Kind: "technology", Value: "Kubernetes"},
+				{Kind: "company", Value: "Capital One"},
+				{Kind: "date", Value: "2019"},
+			},
+		},
+		{
+			name:     "entities from the question",
+			answer:   "No, the work history does not mention Rust or Google Cloud at Netflix.",
+			question: "Did Ethan use Rust or GCP at Netflix?",
+		},
+		{
+			name:     "leading question about an employer",
+			answer:   "Yes, Ethan worked at Google for two years.",
+			question: "Did Ethan work at Google?",
+			want:     []UnsupportedClaim{{Kind: "company", Value: "Google"}},
+		},
+		{
+			name:     "leading question about a technology",
+			answer:   "Yes, he has written Rust in production.",
+			question: "Has Ethan used Rust?",
+			want:     []UnsupportedClaim{{Kind: "technology", Value: "Rust"}},
+		},
+		{
+			name:     "hedged answer to a question",
+			answer:   "The work history is unclear on whether he used Kubernetes at Stripe in 2019.",
+			question: "Did Ethan run Kubernetes at Stripe in 2019?",
+		},
+		{
+			name:   "everyday words that spell technologies",
+			answer: "Go ahead and ask! Rust never sleeps, and Excel at interviews is what he does.",
+		},
+		{
+			name:   "technology mid-sentence",
+			answer: "He also built apps with Rails.",
+			want:   []UnsupportedClaim{{Kind: "technology", Value: "Ruby"}},
+		},
+		{
+			name:   "company inside a longer word",
+			answer: "Ethan worked at Intel for years.",
+			want:   []UnsupportedClaim{{Kind: "company", Value: "Intel"}},
+		},
+		{
+			name:   "names that are not organisations",
+			answer: "You can reach Ethan on LinkedIn. He works with React for The Supplier Management SAAS.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckClaims(tt.answer, tt.question); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("claims = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveClaims(t *testing.T) {
+	claims := []UnsupportedClaim{{Kind: "technology", Value: "Kubernetes"}}
+	answer := "Ethan builds Go services. He also runs k8s clusters! He led the Account Migration.\nSources: account-migration"
+	want := "Ethan builds Go services. He led the Account Migration.\nSources: account-migration"
+	if got := removeClaims(answer, claims); got != want {
+		t.Errorf("removeClaims = %q, want %q", got, want)
+	}
+	if got := removeClaims("He knows Rust. He fixed a Rusty pipeline.", []UnsupportedClaim{{Kind: "technology", Value: "Rust"}}); got != "He fixed a Rusty pipeline." {
+		t.Errorf("removeClaims matched inside a word: %q", got)
+	}
+	if got := removeClaims("He used Kubernetes.\nSources: none", claims); got != ClaimFallbackResponse {
+		t.Errorf("removeClaims with nothing left = %q", got)
+	}
+	if got := withDisclaimer("He used Kubernetes.\nSources: none"); got != "He used Kubernetes.\n\n"+ClaimDisclaimer+"\nSources: none" {
+		t.Errorf("withDisclaimer = %q", got)
+	}
+}
+
+func TestChatHandlerChecksClaims(t *testing.T) {
+	var prompts []string
+	answers := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var system []string
+		for _, message := range body.Messages {
+			if message["role"] == "system" {
+				system = append(system, message["content"])
+			}
+		}
+		prompts = append(prompts, strings.Join(system, "\n"))
+		content := answers[0]
+		answers = answers[1:]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model":   "gpt-3.5-turbo",
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}, "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+
+	newService := func(mode string, replies ...string) *ChatService {
+		service := NewChatService("sk-test")
+		service.Config.CompletionsURL = server.URL
+		service.ClaimCheck = mode
+		service.Metrics = NewMetrics()
+		prompts, answers = nil, replies
+		return service
+	}
+	invented := "Ethan worked at Capital One. He writes Go.\nSources: senior-consultant-at-captech"
+
+	service := newService(ClaimCheckDisclaimer, invented)
+	if _, response := postChat(t, service, "Where does Ethan work?"); !strings.HasSuffix(response.Response, ClaimDisclaimer) || len(response.Citations) != 1 {
+		t.Errorf("disclaimer response = %+v", response)
+	}
+
+	service = newService(ClaimCheckRewrite, invented)
+	if _, response := postChat(t, service, "Where does Ethan work?"); response.Response != "He writes Go." {
+		t.Errorf("rewritten response = %q", response.Response)
+	}
+
+	service = newService(ClaimCheckRetry, invented, "Ethan is a Senior Consultant at CapTech.\nSources: senior-consultant-at-captech")
+	_, response := postChat(t, service, "Where does Ethan work?")
+	if response.Response != "Ethan is a Senior Consultant at CapTech." || len(prompts) != 2 || !strings.Contains(prompts[1], "mentioned Capital One") {
+		t.Errorf("retried response = %q after prompts %d", response.Response, len(prompts))
+	}
+	if service.Metrics.Value("chat_claim_checks_total", "result", "retried") != 1 {
+		t.Error("retry not counted")
+	}
+
+	service = newService(ClaimCheckRetry, invented, invented)
+	if _, response := postChat(t, service, "Where does Ethan work?"); response.Response != "He writes Go." {
+		t.Errorf("failed retry response = %q", response.Response)
+	}
+	if service.Metrics.Value("chat_claim_checks_total", "result", "retry_failed") != 1 || service.Metrics.Value("chat_claim_checks_total", "result", "rewritten") != 0 {
+		t.Error("a failed retry should be counted as retry_failed")
+	}
+
+	service = newService(ClaimCheckOff, invented)
+	if _, response := postChat(t, service, "Where does Ethan work?"); !strings.Contains(response.Response, "Capital One") {
+		t.Errorf("claim check off changed the answer: %q", response.Response)
+	}
+}
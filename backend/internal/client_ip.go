@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the visitor that made the request.
+// When trustProxy is set the right-most X-Forwarded-For entry is used, which is
+// the hop appended by our reverse proxy (Traefik) and cannot be spoofed by the client.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
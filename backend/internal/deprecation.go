@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// RouteDeprecation describes a deprecated route family and where it moved
+type RouteDeprecation struct {
+	Since  time.Time // sent as the Deprecation header
+	Sunset time.Time // sent as the Sunset header, zero if not scheduled
+	// Successor maps the requested path to its replacement, e.g. /api/chat -> /api/v1/chat
+	Successor func(path string) string
+}
+
+// Deprecated marks every response from next with Deprecation (RFC 9745),
+// Sunset (RFC 8594) and a successor-version Link, and records each use so
+// we know when the old routes can be removed.
+func Deprecated(deprecation RouteDeprecation, metrics *Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecation.Since.Unix()))
+			if !deprecation.Sunset.IsZero() {
+				w.Header().Set("Sunset", deprecation.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if deprecation.Successor != nil {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, deprecation.Successor(r.URL.Path)))
+			}
+
+			log.Printf("Deprecated route used: %s %s from %s (user agent %q, request_id=%s)",
+				r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent(), RequestIDFromContext(r.Context()))
+			metrics.Inc("deprecated_route_requests_total", "Requests served by deprecated routes.",
+				"method", r.Method, "route", RouteLabel(r))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
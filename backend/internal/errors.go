@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorCode is a stable, machine-readable error identifier clients can switch on.
+// Never rename an existing code; add a new one instead.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest       ErrorCode = "invalid_request"
+	CodeBodyTooLarge         ErrorCode = "body_too_large"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+
+	CodeInvalidCredentials ErrorCode = "invalid_credentials"
+	CodeAuthRequired       ErrorCode = "auth_required"
+	CodeInvalidToken       ErrorCode = "invalid_token"
+	CodeClientCertRequired ErrorCode = "client_cert_required"
+	CodeAccountNotAllowed  ErrorCode = "account_not_allowed"
+	CodeCSRFFailed         ErrorCode = "csrf_failed"
+
+	CodeSecretNotAllowed    ErrorCode = "secret_not_allowed"
+	CodeSecretNotConfigured ErrorCode = "secret_not_configured"
+	CodeVersionConflict     ErrorCode = "version_conflict"
+	CodeSecretsReadOnly     ErrorCode = "secrets_read_only"
+
+	CodeRateLimited     ErrorCode = "rate_limited"
+	CodeQuotaExceeded   ErrorCode = "quota_exceeded"
+	CodeChatDisabled    ErrorCode = "chat_disabled"
+	CodeMessageTooLong  ErrorCode = "message_too_long"
+	CodeMessageRejected ErrorCode = "message_rejected"
+	CodeUpstreamBusy    ErrorCode = "upstream_rate_limited"
+	CodeUpstreamDown    ErrorCode = "upstream_unavailable"
+	CodeUpstreamFailed  ErrorCode = "upstream_error"
+
+	CodeInternal ErrorCode = "internal_error"
+)
+
+// retryableCodes are errors a client may retry unchanged, after RetryAfter if set
+var retryableCodes = map[ErrorCode]bool{
+	CodeRateLimited:  true,
+	CodeUpstreamBusy: true,
+	CodeUpstreamDown: true,
+}
+
+// ErrorResponse is the error body returned by every endpoint. The message stays
+// under "error" so clients that only read a string keep working.
+type ErrorResponse struct {
+	Message    string    `json:"error"`
+	Code       ErrorCode `json:"code"`
+	Status     int       `json:"status"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Retryable  bool      `json:"retryable"`
+	RetryAfter int       `json:"retry_after,omitempty"` // seconds
+}
+
+// WriteError writes an ErrorResponse with the request ID of r
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string) {
+	WriteErrorRetryAfter(w, r, status, code, message, 0)
+}
+
+// WriteErrorRetryAfter is WriteError with a Retry-After hint in the header and body
+func WriteErrorRetryAfter(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, message string, retryAfter time.Duration) {
+	response := ErrorResponse{
+		Message:   message,
+		Code:      code,
+		Status:    status,
+		RequestID: RequestIDFromContext(r.Context()),
+		Retryable: retryableCodes[code],
+	}
+	if retryAfter > 0 {
+		response.RetryAfter = int(math.Ceil(retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfter))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write error response: %v", err)
+	}
+}
+
+// NotFoundHandler and MethodNotAllowedHandler keep router-level errors in the same shape
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusNotFound, CodeNotFound, "Not found")
+	})
+}
+
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	})
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics is a small registry of labelled counters exposed in the Prometheus
+// text format. A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[string]*counterFamily
+}
+
+type counterFamily struct {
+	help   string
+	values map[string]float64 // keyed by rendered label set
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{counters: make(map[string]*counterFamily)}
+}
+
+// Inc adds one to the counter. labels are alternating name, value pairs.
+func (m *Metrics) Inc(name, help string, labels ...string) {
+	m.Add(name, help, 1, labels...)
+}
+
+// Add adds value to the counter. labels are alternating name, value pairs.
+func (m *Metrics) Add(name, help string, value float64, labels ...string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	family, ok := m.counters[name]
+	if !ok {
+		family = &counterFamily{help: help, values: make(map[string]float64)}
+		m.counters[name] = family
+	}
+	family.values[renderLabels(labels)] += value
+}
+
+// Value returns the current value of a counter, mainly for tests
+func (m *Metrics) Value(name string, labels ...string) float64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if family, ok := m.counters[name]; ok {
+		return family.values[renderLabels(labels)]
+	}
+	return 0
+}
+
+// Handler serves all counters in the Prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if m == nil {
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		names := make([]string, 0, len(m.counters))
+		for name := range m.counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			family := m.counters[name]
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, family.help, name)
+			series := make([]string, 0, len(family.values))
+			for labels := range family.values {
+				series = append(series, labels)
+			}
+			sort.Strings(series)
+			for _, labels := range series {
+				fmt.Fprintf(w, "%s%s %g\n", name, labels, family.values[labels])
+			}
+		}
+	})
+}
+
+// RouteLabel returns the matched route template (e.g. /api/v1/secrets/{secretName})
+// so metric labels stay bounded no matter what paths clients request
+func RouteLabel(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
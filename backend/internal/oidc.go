@@ -0,0 +1,327 @@
+package internal
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCProvider signs users in with an OpenID Connect issuer using the
+// authorization code flow with PKCE. The discovery document and signing keys
+// are fetched on first use and the keys refreshed when an unknown key ID appears.
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // optional for public clients; PKCE protects the code either way
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{} // by kid
+	keysAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCIdentity is the verified content of an ID token
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// Claims holds every claim for role mapping
+	Claims map[string]interface{}
+}
+
+// OIDCLogin is the per-login state kept by the browser between the redirect
+// to the issuer and the callback
+type OIDCLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// oidcKeyRefreshInterval stops a flood of unknown key IDs from hammering the issuer
+const oidcKeyRefreshInterval = time.Minute
+
+// NewOIDCLogin creates random state, nonce and PKCE verifier values
+func NewOIDCLogin() OIDCLogin {
+	return OIDCLogin{State: randomToken(16), Nonce: randomToken(16), Verifier: randomToken(32)}
+}
+
+// AuthCodeURL returns the issuer URL to send the browser to
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, login OIDCLogin) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified identity
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login OIDCLogin) (OIDCIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {login.Verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("token request: %w", err)
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return OIDCIdentity{}, fmt.Errorf("token request: status %d %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	return p.VerifyIDToken(ctx, tokens.IDToken, login.Nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (OIDCIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("id token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return OIDCIdentity{}, errors.New("id token: nonce mismatch")
+	}
+
+	identity := OIDCIdentity{Claims: claims}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	return identity, nil
+}
+
+// ClaimValues returns a claim as strings, accepting a string or a list
+func (i OIDCIdentity) ClaimValues(name string) []string {
+	switch value := i.Claims[name].(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	status, err := p.doJSON(req, &discovery)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery: status %d: %v", status, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing authorization, token or jwks endpoint")
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysAt) >= oidcKeyRefreshInterval
+	jwksURI := p.discovery.JWKSURI
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys, p.keysAt = keys, time.Now()
+	p.mu.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("jwks: status %d: %v", status, err)
+	}
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // skip key types we cannot use
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, out interface{}) (int, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
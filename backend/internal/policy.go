@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exposure controls how much of a secret a reader receives
+const (
+	ExposureRaw         = "raw"
+	ExposureMasked      = "masked"
+	ExposureFingerprint = "fingerprint"
+)
+
+// SecretPolicy declares who may read a secret, from where, when and how
+// often. Empty lists allow everyone; a reader must pass every check.
+type SecretPolicy struct {
+	// Roles and Subjects allow a reader holding any listed role or named as
+	// a listed subject. Both empty allows any authenticated reader.
+	Roles    []string `yaml:"roles,omitempty" json:"roles,omitempty"`
+	Subjects []string `yaml:"subjects,omitempty" json:"subjects,omitempty"`
+	// Origins must contain the request's Origin header, e.g. https://ethanmerrill.com
+	Origins []string `yaml:"origins,omitempty" json:"origins,omitempty"`
+	// Windows restrict reads to these times in Timezone (default UTC)
+	Windows  []TimeWindow `yaml:"windows,omitempty" json:"windows,omitempty"`
+	Timezone string       `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	// MaxReadsPerHour limits reads per subject; 0 is unlimited
+	MaxReadsPerHour int `yaml:"max_reads_per_hour,omitempty" json:"max_reads_per_hour,omitempty"`
+	// Exposure is raw (default), masked or fingerprint
+	Exposure string `yaml:"exposure,omitempty" json:"exposure,omitempty"`
+}
+
+// TimeWindow is a daily period such as 08:00-20:00 on weekdays. End before
+// Start spans midnight. Empty Days means every day.
+type TimeWindow struct {
+	Days  []string `yaml:"days,omitempty" json:"days,omitempty"` // mon, tue, ... sun
+	Start string   `yaml:"start" json:"start"`                   // HH:MM
+	End   string   `yaml:"end" json:"end"`                       // HH:MM
+}
+
+// DefaultSecretPolicies keep the original behaviour: any authenticated
+// visitor can read the raw openai and firebase keys.
+var DefaultSecretPolicies = map[string]SecretPolicy{
+	"openai":   {},
+	"firebase": {},
+}
+
+// SecretAccess describes a read to evaluate
+type SecretAccess struct {
+	Secret  string
+	Subject string
+	Roles   []string
+	Origin  string
+	Time    time.Time
+}
+
+// SecretDecision is the outcome of a policy evaluation. Reason explains a
+// denial for the audit log; RetryAfter is set when the hourly limit applies.
+type SecretDecision struct {
+	Allowed    bool
+	Reason     string
+	Exposure   string
+	RetryAfter time.Duration
+}
+
+// SecretPolicyEngine evaluates reads against the configured policies.
+// Secrets without a policy cannot be read.
+type SecretPolicyEngine struct {
+	policies map[string]compiledPolicy
+
+	mu        sync.Mutex
+	reads     map[string][]time.Time // by secret and subject, oldest first
+	lastSweep time.Time
+}
+
+type compiledPolicy struct {
+	SecretPolicy
+	location *time.Location
+	windows  []compiledWindow
+}
+
+type compiledWindow struct {
+	days       map[time.Weekday]bool
+	start, end int // minutes after midnight
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// NewSecretPolicyEngine validates and compiles policies keyed by secret name
+func NewSecretPolicyEngine(policies map[string]SecretPolicy) (*SecretPolicyEngine, error) {
+	engine := &SecretPolicyEngine{policies: map[string]compiledPolicy{}, reads: map[string][]time.Time{}}
+	var errs []error
+	for name, policy := range policies {
+		compiled, err := compilePolicy(policy)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("policy for %s: %w", name, err))
+			continue
+		}
+		engine.policies[name] = compiled
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+func compilePolicy(policy SecretPolicy) (compiledPolicy, error) {
+	compiled := compiledPolicy{SecretPolicy: policy, location: time.UTC}
+	switch policy.Exposure {
+	case "":
+		compiled.Exposure = ExposureRaw
+	case ExposureRaw, ExposureMasked, ExposureFingerprint:
+	default:
+		return compiled, fmt.Errorf("exposure must be raw, masked or fingerprint, got %q", policy.Exposure)
+	}
+	if policy.MaxReadsPerHour < 0 {
+		return compiled, errors.New("max_reads_per_hour must not be negative")
+	}
+	if policy.Timezone != "" {
+		location, err := time.LoadLocation(policy.Timezone)
+		if err != nil {
+			return compiled, fmt.Errorf("timezone: %w", err)
+		}
+		compiled.location = location
+	}
+	for _, window := range policy.Windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return compiled, err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return compiled, err
+		}
+		days := map[time.Weekday]bool{}
+		for _, day := range window.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return compiled, fmt.Errorf("unknown day %q, use mon-sun", day)
+			}
+			days[weekday] = true
+		}
+		compiled.windows = append(compiled.windows, compiledWindow{days: days, start: start, end: end})
+	}
+	return compiled, nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time %q must be HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Evaluate checks a read and, when allowed, counts it against the hourly limit
+func (e *SecretPolicyEngine) Evaluate(access SecretAccess) SecretDecision {
+	policy, ok := e.policies[access.Secret]
+	if !ok {
+		return SecretDecision{Reason: "no policy for secret"}
+	}
+	if !policy.allowsReader(access.Subject, access.Roles) {
+		return SecretDecision{Reason: fmt.Sprintf("subject %q with roles [%s] not allowed", access.Subject, strings.Join(access.Roles, ","))}
+	}
+	if len(policy.Origins) > 0 && !containsFold(policy.Origins, access.Origin) {
+		if access.Origin == "" {
+			return SecretDecision{Reason: "origin required"}
+		}
+		return SecretDecision{Reason: fmt.Sprintf("origin %q not allowed", access.Origin)}
+	}
+	if len(policy.windows) > 0 && !policy.inWindow(access.Time) {
+		return SecretDecision{Reason: fmt.Sprintf("outside allowed time windows at %s", access.Time.In(policy.location).Format("Mon 15:04 MST"))}
+	}
+	if policy.MaxReadsPerHour > 0 {
+		if retryAfter := e.countRead(access, policy.MaxReadsPerHour); retryAfter > 0 {
+			return SecretDecision{Reason: fmt.Sprintf("more than %d reads in the last hour", policy.MaxReadsPerHour), RetryAfter: retryAfter}
+		}
+	}
+	return SecretDecision{Allowed: true, Exposure: policy.Exposure}
+}
+
+// Names lists the secrets that have a policy
+func (e *SecretPolicyEngine) Names() []string {
+	names := make([]string, 0, len(e.policies))
+	for name := range e.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p compiledPolicy) allowsReader(subject string, roles []string) bool {
+	if len(p.Roles) == 0 && len(p.Subjects) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if contains(p.Roles, role) {
+			return true
+		}
+	}
+	return contains(p.Subjects, subject)
+}
+
+func (p compiledPolicy) inWindow(t time.Time) bool {
+	t = t.In(p.location)
+	minute := t.Hour()*60 + t.Minute()
+	yesterday := t.AddDate(0, 0, -1).Weekday()
+	for _, w := range p.windows {
+		if w.start <= w.end {
+			if w.allowsDay(t.Weekday()) && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Spans midnight: the evening part belongs to today, the morning part to yesterday
+		if (w.allowsDay(t.Weekday()) && minute >= w.start) || (w.allowsDay(yesterday) && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w compiledWindow) allowsDay(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
+
+// countRead records a read unless the subject already reached limit in the
+// last hour, in which case it returns how long until the oldest read expires
+func (e *SecretPolicyEngine) countRead(access SecretAccess, limit int) time.Duration {
+	key := access.Secret + "\x00" + access.Subject
+	cutoff := access.Time.Add(-time.Hour)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sweep(access.Time)
+	reads := e.reads[key]
+	for len(reads) > 0 && !reads[0].After(cutoff) {
+		reads = reads[1:]
+	}
+	if len(reads) >= limit {
+		e.reads[key] = reads
+		return reads[0].Sub(cutoff)
+	}
+	e.reads[key] = append(reads, access.Time)
+	return 0
+}
+
+// sweep forgets subjects with no reads in the last hour so the map doesn't
+// grow without bound
+func (e *SecretPolicyEngine) sweep(now time.Time) {
+	if now.Sub(e.lastSweep) < 10*time.Minute {
+		return
+	}
+	e.lastSweep = now
+
+	cutoff := now.Add(-time.Hour)
+	for key, reads := range e.reads {
+		if len(reads) == 0 || !reads[len(reads)-1].After(cutoff) {
+			delete(e.reads, key)
+		}
+	}
+}
+
+// ExposeSecret returns the value as the exposure level allows
+func ExposeSecret(value, exposure string) string {
+	switch exposure {
+	case ExposureMasked:
+		return MaskSecret(value)
+	case ExposureFingerprint:
+		return SecretFingerprint(value)
+	default:
+		return value
+	}
+}
+
+// MaskSecret keeps enough of a value to recognise it: the first 3 and last
+// 4 characters of values of 12 or more characters
+func MaskSecret(value string) string {
+	if len(value) < 12 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:3] + strings.Repeat("*", len(value)-7) + value[len(value)-4:]
+}
+
+// SecretFingerprint identifies a value without revealing it
+func SecretFingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
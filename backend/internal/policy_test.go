@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretPolicyEngine(t *testing.T) {
+	engine, err := NewSecretPolicyEngine(map[string]SecretPolicy{
+		"open":     {},
+		"admins":   {Roles: []string{"admin"}, Subjects: []string{"ethan"}},
+		"site":     {Origins: []string{"https://ethanmerrill.com"}},
+		"weekdays": {Windows: []TimeWindow{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "18:00"}}, Timezone: "America/New_York"},
+		"nightly":  {Windows: []TimeWindow{{Days: []string{"sat"}, Start: "22:00", End: "02:00"}}},
+		"masked":   {Exposure: ExposureMasked},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tuesday 2026-10-20 12:00 in New York
+	tuesdayNoon := time.Date(2026, 10, 20, 16, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		access SecretAccess
+		allow  bool
+		reason string
+	}{
+		{"any reader", SecretAccess{Secret: "open", Subject: "visitor"}, true, ""},
+		{"no policy", SecretAccess{Secret: "database", Subject: "visitor"}, false, "no policy"},
+		{"role", SecretAccess{Secret: "admins", Subject: "sam", Roles: []string{"visitor", "admin"}}, true, ""},
+		{"subject", SecretAccess{Secret: "admins", Subject: "ethan"}, true, ""},
+		{"neither", SecretAccess{Secret: "admins", Subject: "sam", Roles: []string{"visitor"}}, false, `subject "sam" with roles [visitor] not allowed`},
+		{"origin", SecretAccess{Secret: "site", Origin: "https://EthanMerrill.com"}, true, ""},
+		{"wrong origin", SecretAccess{Secret: "site", Origin: "https://evil.example"}, false, "not allowed"},
+		{"missing origin", SecretAccess{Secret: "site"}, false, "origin required"},
+		{"in window", SecretAccess{Secret: "weekdays", Time: tuesdayNoon}, true, ""},
+		{"after hours", SecretAccess{Secret: "weekdays", Time: tuesdayNoon.Add(7 * time.Hour)}, false, "outside allowed time windows at Tue 19:00 EDT"},
+		{"weekend", SecretAccess{Secret: "weekdays", Time: tuesdayNoon.AddDate(0, 0, 5)}, false, "outside"},
+		{"overnight evening", SecretAccess{Secret: "nightly", Time: time.Date(2026, 10, 24, 23, 0, 0, 0, time.UTC)}, true, ""},
+		{"overnight morning", SecretAccess{Secret: "nightly", Time: time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC)}, true, ""},
+		{"overnight wrong day", SecretAccess{Secret: "nightly", Time: time.Date(2026, 10, 24, 1, 0, 0, 0, time.UTC)}, false, "outside"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.access.Time.IsZero() {
+				tt.access.Time = tuesdayNoon
+			}
+			decision := engine.Evaluate(tt.access)
+			if decision.Allowed != tt.allow || !strings.Contains(decision.Reason, tt.reason) {
+				t.Errorf("Evaluate = %+v, want allowed %t with reason containing %q", decision, tt.allow, tt.reason)
+			}
+		})
+	}
+
+	if decision := engine.Evaluate(SecretAccess{Secret: "masked", Time: tuesdayNoon}); decision.Exposure != ExposureMasked {
+		t.Errorf("exposure = %q, want masked", decision.Exposure)
+	}
+	if decision := engine.Evaluate(SecretAccess{Secret: "open", Time: tuesdayNoon}); decision.Exposure != ExposureRaw {
+		t.Errorf("default exposure = %q, want raw", decision.Exposure)
+	}
+}
+
+func TestSecretPolicyHourlyLimit(t *testing.T) {
+	engine, _ := NewSecretPolicyEngine(map[string]SecretPolicy{"limited": {MaxReadsPerHour: 2}})
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	read := func(subject string, at time.Duration) SecretDecision {
+		return engine.Evaluate(SecretAccess{Secret: "limited", Subject: subject, Time: start.Add(at)})
+	}
+
+	read("visitor", 0)
+	read("visitor", 10*time.Minute)
+	decision := read("visitor", 20*time.Minute)
+	if decision.Allowed || decision.RetryAfter != 40*time.Minute {
+		t.Errorf("third read = %+v, want denied with 40m retry", decision)
+	}
+	if !read("other", 20*time.Minute).Allowed {
+		t.Error("limits should apply per subject")
+	}
+	if !read("visitor", 61*time.Minute).Allowed {
+		t.Error("read after the oldest one expired should be allowed")
+	}
+
+	read("later", 3*time.Hour)
+	if len(engine.reads) != 1 {
+		t.Errorf("idle subjects kept: %d entries, want 1", len(engine.reads))
+	}
+}
+
+func TestSecretPolicyValidation(t *testing.T) {
+	_, err := NewSecretPolicyEngine(map[string]SecretPolicy{
+		"a": {Exposure: "partial"},
+		"b": {Windows: []TimeWindow{{Start: "9am", End: "17:00"}}},
+		"c": {Windows: []TimeWindow{{Days: []string{"someday"}, Start: "09:00", End: "17:00"}}},
+		"d": {Timezone: "Mars/Olympus"},
+	})
+	for _, want := range []string{"policy for a: exposure", `time "9am"`, `unknown day "someday"`, "policy for d: timezone"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in error, got %v", want, err)
+		}
+	}
+}
+
+func TestExposeSecret(t *testing.T) {
+	key := "sk-proj-abcdefghijklmnop1234"
+	if got := ExposeSecret(key, ExposureRaw); got != key {
+		t.Errorf("raw = %q", got)
+	}
+	if got := ExposeSecret(key, ExposureMasked); got != "sk-*********************1234" {
+		t.Errorf("masked = %q", got)
+	}
+	if got := ExposeSecret("short", ExposureMasked); got != "*****" {
+		t.Errorf("masked short value = %q", got)
+	}
+	if got := ExposeSecret(key, ExposureFingerprint); !strings.HasPrefix(got, "sha256:") || len(got) != 7+64 {
+		t.Errorf("fingerprint = %q", got)
+	}
+}
@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// PromptTemplate is a named, versioned system prompt written as a Go
+// text/template over PromptVariables. Bump Version whenever Text changes so
+// logged exchanges can be compared across versions.
+type PromptTemplate struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Text    string `yaml:"text"`
+}
+
+// ID names a template version, e.g. "default@1"
+func (t PromptTemplate) ID() string {
+	return t.Name + "@" + t.Version
+}
+
+// PromptVariables are available to prompt templates
+type PromptVariables struct {
+	// WorkHistory is the full work history, headings tagged with section IDs
+	WorkHistory string
+	// WorkHistoryExcerpt is the sections relevant to the question, or the
+	// full work history when none stand out
+	WorkHistoryExcerpt string
+	// CitationInstructions ask the model for a Sources line; without them
+	// citations fall back to section titles the answer mentions
+	CitationInstructions string
+	// Locale is the visitor's preferred language from Accept-Language, e.g. "en-US"
+	Locale string
+	// Date is today's date, e.g. "October 18, 2026"
+	Date string
+}
+
+// DefaultPromptTemplate is the built-in "default" template
+var DefaultPromptTemplate = PromptTemplate{
+	Name:    "default",
+	Version: "1",
+	Text: `{{.WorkHistory}}
+
+You are Ethan's AI assistant on his portfolio website. Be helpful, professional, and represent Ethan well. Keep responses concise and engaging. Reference the work history above if relevant.
+
+{{.CitationInstructions}}`,
+}
+
+// PromptWeights picks the templates in use and their share of conversations.
+// It can be set from an env var as "default=90,concise=10"; a name without a
+// weight counts as 1.
+type PromptWeights map[string]int
+
+func (w *PromptWeights) UnmarshalText(text []byte) error {
+	weights := PromptWeights{}
+	for _, entry := range strings.Split(string(text), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, weight, found := strings.Cut(entry, "=")
+		weights[strings.TrimSpace(name)] = 1
+		if found {
+			parsed, err := strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil {
+				return fmt.Errorf("weight of prompt %q must be an integer, got %q", name, weight)
+			}
+			weights[strings.TrimSpace(name)] = parsed
+		}
+	}
+	*w = weights
+	return nil
+}
+
+// PromptTemplates are the parsed templates in use, with their A/B weights
+type PromptTemplates struct {
+	active []activePrompt
+	total  int
+	// version changes whenever any template in use does
+	version string
+}
+
+type activePrompt struct {
+	PromptTemplate
+	weight       int
+	parsed       *template.Template
+	instructions map[string]bool
+}
+
+// NewPromptTemplates parses templates, which extend and may replace the
+// built-in default, and selects those named in weights. Each selected
+// template is rendered once so mistakes surface at startup.
+func NewPromptTemplates(templates []PromptTemplate, weights PromptWeights) (*PromptTemplates, error) {
+	return newPromptTemplates(templates, weights, AnnotatedWorkHistory())
+}
+
+// newPromptTemplates is NewPromptTemplates with the work history the version covers
+func newPromptTemplates(templates []PromptTemplate, weights PromptWeights, workHistory string) (*PromptTemplates, error) {
+	byName := map[string]PromptTemplate{DefaultPromptTemplate.Name: DefaultPromptTemplate}
+	var errs []error
+	seen := map[string]bool{}
+	for i, tmpl := range templates {
+		switch {
+		case tmpl.Name == "" || tmpl.Version == "" || tmpl.Text == "":
+			errs = append(errs, fmt.Errorf("prompt template %d: name, version and text are required", i))
+			continue
+		case seen[tmpl.Name]:
+			errs = append(errs, fmt.Errorf("prompt template %q is defined twice", tmpl.Name))
+			continue
+		}
+		seen[tmpl.Name] = true
+		byName[tmpl.Name] = tmpl
+	}
+	if len(weights) == 0 {
+		weights = PromptWeights{DefaultPromptTemplate.Name: 1}
+	}
+
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	prompts := &PromptTemplates{}
+	var ids []string
+	for _, name := range names {
+		tmpl, ok := byName[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("prompt %q has no template", name))
+			continue
+		case weights[name] < 0:
+			errs = append(errs, fmt.Errorf("prompt %q: weight must not be negative, got %d", name, weights[name]))
+			continue
+		case weights[name] == 0:
+			continue
+		}
+		parsed, err := template.New(tmpl.ID()).Option("missingkey=error").Parse(tmpl.Text)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prompt template %s: %w", tmpl.ID(), err))
+			continue
+		}
+		// Rendered without the work history, a template is only its instructions
+		var instructions strings.Builder
+		if err := parsed.Execute(&instructions, PromptVariables{CitationInstructions: citationInstructions, Locale: "en", Date: "January 2, 2006"}); err != nil {
+			errs = append(errs, fmt.Errorf("prompt template %s: %w", tmpl.ID(), err))
+			continue
+		}
+		prompts.active = append(prompts.active, activePrompt{PromptTemplate: tmpl, weight: weights[name], parsed: parsed, instructions: shingles(instructions.String())})
+		prompts.total += weights[name]
+		ids = append(ids, tmpl.ID()+"\n"+tmpl.Text)
+	}
+	if len(errs) == 0 && prompts.total == 0 {
+		errs = append(errs, errors.New("at least one prompt needs a positive weight"))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	// Templates render the work history, so it is part of the version too
+	ids = append(ids, PromptVersion(workHistory))
+	prompts.version = PromptVersion(strings.Join(ids, "\n"))
+	return prompts, nil
+}
+
+// defaultPromptTemplates is used by a ChatService without Prompts
+var defaultPromptTemplates = sync.OnceValue(func() *PromptTemplates {
+	prompts, err := NewPromptTemplates(nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	return prompts
+})
+
+// Version identifies the templates in use and the work history they render;
+// answers cached under another version are dropped
+func (p *PromptTemplates) Version() string {
+	return p.version
+}
+
+// String lists the templates in use with their weights, e.g. "default@1=90, concise@2=10"
+func (p *PromptTemplates) String() string {
+	entries := make([]string, len(p.active))
+	for i, prompt := range p.active {
+		entries[i] = prompt.ID() + "=" + strconv.Itoa(prompt.weight)
+	}
+	return strings.Join(entries, ", ")
+}
+
+// assign picks the template for a conversation. The same conversation always
+// gets the same template, and conversations split between templates in
+// proportion to their weights.
+func (p *PromptTemplates) assign(conversationID string) *activePrompt {
+	if len(p.active) == 1 {
+		return &p.active[0]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(conversationID))
+	point := int(hash.Sum32() % uint32(p.total))
+	for i := range p.active {
+		if point < p.active[i].weight {
+			return &p.active[i]
+		}
+		point -= p.active[i].weight
+	}
+	return &p.active[len(p.active)-1]
+}
+
+// render executes the template for a question
+func (a *activePrompt) render(question, locale string, now time.Time) (string, error) {
+	var prompt strings.Builder
+	err := a.parsed.Execute(&prompt, PromptVariables{
+		WorkHistory:          AnnotatedWorkHistory(),
+		WorkHistoryExcerpt:   WorkHistoryExcerpt(question),
+		CitationInstructions: citationInstructions,
+		Locale:               locale,
+		Date:                 now.Format("January 2, 2006"),
+	})
+	return prompt.String(), err
+}
+
+// usesLocale reports whether answers depend on the visitor's locale, so they
+// are cached per locale
+func (a *activePrompt) usesLocale() bool {
+	return strings.Contains(a.Text, ".Locale")
+}
+
+// WorkHistoryExcerpt returns the sections of the work history a question is
+// about: those whose title it names or whose technologies it mentions, with
+// the role each project belongs to. Without any, it is the full work history.
+func WorkHistoryExcerpt(question string) string {
+	sections := WorkHistory()
+	lower := strings.ToLower(question)
+	asked := MentionedTechnologies(question)
+
+	include := map[string]bool{}
+	for _, section := range sections {
+		relevant := strings.Contains(lower, strings.ToLower(section.Title))
+		for _, tech := range section.Technologies {
+			relevant = relevant || contains(asked, tech)
+		}
+		if relevant {
+			include[section.ID] = true
+			if section.RoleID != "" {
+				include[section.RoleID] = true
+			}
+		}
+	}
+	if len(include) == 0 {
+		return AnnotatedWorkHistory()
+	}
+
+	var excerpt []string
+	for _, section := range sections {
+		if !include[section.ID] {
+			continue
+		}
+		heading := "### "
+		if section.Kind == "project" {
+			heading = "#### "
+		}
+		lines := []string{heading + section.Title + " [id: " + section.ID + "]"}
+		if section.Dates != "" {
+			lines = append(lines, "_"+section.Dates+"_")
+		}
+		if section.Text != "" {
+			lines = append(lines, section.Text)
+		}
+		excerpt = append(excerpt, strings.Join(lines, "\n"))
+	}
+	return strings.Join(excerpt, "\n\n")
+}
+
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(?:-[A-Za-z0-9]{2,8})*$`)
+
+// VisitorLocale returns the first language of an Accept-Language header, or "en"
+func VisitorLocale(acceptLanguage string) string {
+	first, _, _ := strings.Cut(acceptLanguage, ",")
+	first, _, _ = strings.Cut(first, ";")
+	first = strings.TrimSpace(first)
+	if !localePattern.MatchString(first) {
+		return "en"
+	}
+	return first
+}
+
+var conversationIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validConversationID reports whether a client-supplied conversation ID is usable
+func validConversationID(id string) bool {
+	return conversationIDPattern.MatchString(id)
+}
+
+// newConversationID returns a random conversation ID for clients that did not send one
+func newConversationID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
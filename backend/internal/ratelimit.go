@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy describes the token bucket and daily quota applied to a route
+type RateLimitPolicy struct {
+	Name       string
+	PerMinute  int // sustained requests per minute
+	Burst      int // bucket capacity, i.e. requests allowed back to back
+	DailyQuota int // requests per visitor per UTC day, 0 disables the quota
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type dailyCounter struct {
+	day   string
+	count int
+}
+
+type rateLimitDecision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+	code       ErrorCode
+	reason     string
+}
+
+// RateLimiter enforces RateLimitPolicy values per visitor. A visitor is the
+// pair of token subject (when SubjectFunc is set) and client IP.
+type RateLimiter struct {
+	SubjectFunc func(*http.Request) string
+	TrustProxy  bool
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	quotas    map[string]*dailyCounter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter(subjectFunc func(*http.Request) string, trustProxy bool) *RateLimiter {
+	return &RateLimiter{
+		SubjectFunc: subjectFunc,
+		TrustProxy:  trustProxy,
+		buckets:     make(map[string]*tokenBucket),
+		quotas:      make(map[string]*dailyCounter),
+		now:         time.Now,
+	}
+}
+
+// Limit wraps next with the given policy. Rejected requests get a 429
+// ErrorResponse along with Retry-After.
+func (l *RateLimiter) Limit(policy RateLimitPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.visitorKey(r)
+		decision := l.allow(policy, key)
+
+		w.Header().Set("RateLimit-Policy", policy.header())
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.PerMinute))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.reset)))
+
+		if !decision.allowed {
+			log.Printf("Rate limit exceeded for %s on %s (%s)", key, policy.Name, decision.reason)
+			WriteErrorRetryAfter(w, r, http.StatusTooManyRequests, decision.code, decision.reason, decision.retryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reset drops all buckets and quota counters
+func (l *RateLimiter) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets = make(map[string]*tokenBucket)
+	l.quotas = make(map[string]*dailyCounter)
+}
+
+func (l *RateLimiter) visitorKey(r *http.Request) string {
+	subject := ""
+	if l.SubjectFunc != nil {
+		subject = l.SubjectFunc(r)
+	}
+	return subject + "|" + ClientIP(r, l.TrustProxy)
+}
+
+func (l *RateLimiter) allow(policy RateLimitPolicy, key string) rateLimitDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	rate := float64(policy.PerMinute) / 60
+	capacity := float64(policy.Burst)
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	bucketKey := policy.Name + "|" + key
+	bucket, ok := l.buckets[bucketKey]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		l.buckets[bucketKey] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return rateLimitDecision{
+			remaining:  0,
+			reset:      secondsToDuration((capacity - bucket.tokens) / rate),
+			retryAfter: secondsToDuration((1 - bucket.tokens) / rate),
+			code:       CodeRateLimited,
+			reason:     "Too many messages. Please slow down and try again shortly.",
+		}
+	}
+
+	var quota *dailyCounter
+	day := now.UTC().Format("2006-01-02")
+	if policy.DailyQuota > 0 {
+		quota, ok = l.quotas[bucketKey]
+		if !ok || quota.day != day {
+			quota = &dailyCounter{day: day}
+			l.quotas[bucketKey] = quota
+		}
+		if quota.count >= policy.DailyQuota {
+			untilTomorrow := untilNextUTCDay(now)
+			return rateLimitDecision{
+				remaining:  0,
+				reset:      untilTomorrow,
+				retryAfter: untilTomorrow,
+				code:       CodeQuotaExceeded,
+				reason:     "Daily message limit reached. Please come back tomorrow.",
+			}
+		}
+		quota.count++
+	}
+
+	bucket.tokens--
+	decision := rateLimitDecision{
+		allowed:   true,
+		remaining: int(bucket.tokens),
+		reset:     secondsToDuration((capacity - bucket.tokens) / rate),
+	}
+	if quota != nil && policy.DailyQuota-quota.count < decision.remaining {
+		decision.remaining = policy.DailyQuota - quota.count
+		decision.reset = untilNextUTCDay(now)
+	}
+	return decision
+}
+
+// sweep forgets idle visitors so the maps don't grow without bound
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < 10*time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	day := now.UTC().Format("2006-01-02")
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+	for key, quota := range l.quotas {
+		if quota.day != day {
+			delete(l.quotas, key)
+		}
+	}
+}
+
+func (p RateLimitPolicy) header() string {
+	policy := fmt.Sprintf("%d;w=60;burst=%d", p.PerMinute, p.Burst)
+	if p.DailyQuota > 0 {
+		policy += fmt.Sprintf(", %d;w=86400", p.DailyQuota)
+	}
+	return policy
+}
+
+func untilNextUTCDay(now time.Time) time.Duration {
+	utc := now.UTC()
+	tomorrow := time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC)
+	return tomorrow.Sub(utc)
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
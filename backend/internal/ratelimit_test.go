@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(nil, false)
+	limiter.now = func() time.Time { return now }
+
+	policy := RateLimitPolicy{Name: "chat", PerMinute: 6, Burst: 2}
+	handler := limiter.Limit(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/chat", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := send(); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i, rr.Code)
+		}
+	}
+
+	rr := send()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want 429", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "10" {
+		t.Errorf("Retry-After = %q, want 10", rr.Header().Get("Retry-After"))
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Code != CodeRateLimited || !body.Retryable || body.RetryAfter != 10 {
+		t.Errorf("expected rate_limited error body, got %q", rr.Body.String())
+	}
+
+	now = now.Add(10 * time.Second)
+	if rr := send(); rr.Code != http.StatusOK {
+		t.Fatalf("after refill: got status %d, want 200", rr.Code)
+	}
+}
+
+func TestRateLimiterDailyQuota(t *testing.T) {
+	now := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(func(r *http.Request) string { return "visitor" }, false)
+	limiter.now = func() time.Time { return now }
+
+	policy := RateLimitPolicy{Name: "chat", PerMinute: 60, Burst: 10, DailyQuota: 2}
+	handler := limiter.Limit(policy, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/chat", nil))
+		codes = append(codes, rr.Code)
+		if i == 1 && rr.Header().Get("RateLimit-Remaining") != "0" {
+			t.Errorf("RateLimit-Remaining = %q, want 0", rr.Header().Get("RateLimit-Remaining"))
+		}
+	}
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status codes %v", codes)
+	}
+
+	now = now.Add(2 * time.Hour)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/api/chat", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("quota should reset on a new UTC day, got %d", rr.Code)
+	}
+}
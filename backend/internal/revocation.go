@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenRevocations tracks revoked JWTs by ID (jti), plus a cutoff that
+// revokes every token issued before it. Entries are dropped once the token
+// would have expired anyway. State is in memory: a restart forgets it, so
+// rotate JWT_SECRET to revoke tokens permanently. A nil *TokenRevocations
+// revokes nothing.
+type TokenRevocations struct {
+	mu           sync.Mutex
+	ids          map[string]time.Time // jti -> token expiry
+	issuedBefore time.Time
+	now          func() time.Time
+}
+
+func NewTokenRevocations() *TokenRevocations {
+	return &TokenRevocations{ids: make(map[string]time.Time), now: time.Now}
+}
+
+// Revoke rejects the token with this ID until it expires
+func (t *TokenRevocations) Revoke(id string, expiresAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	t.ids[id] = expiresAt
+}
+
+// RevokeIssuedBefore rejects every token issued before cutoff. Token issue
+// times have second precision, so the cutoff is truncated to match.
+func (t *TokenRevocations) RevokeIssuedBefore(cutoff time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cutoff = cutoff.Truncate(time.Second)
+	if cutoff.After(t.issuedBefore) {
+		t.issuedBefore = cutoff
+	}
+}
+
+// IsRevoked reports whether a token with this ID and issue time was revoked.
+// Tokens without an issue time are treated as issued at the zero time.
+func (t *TokenRevocations) IsRevoked(id string, issuedAt time.Time) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.issuedBefore.IsZero() && issuedAt.Before(t.issuedBefore) {
+		return true
+	}
+	_, revoked := t.ids[id]
+	return id != "" && revoked
+}
+
+// Len returns the number of individually revoked tokens still tracked
+func (t *TokenRevocations) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	return len(t.ids)
+}
+
+func (t *TokenRevocations) prune() {
+	now := t.now()
+	for id, expiresAt := range t.ids {
+		if now.After(expiresAt) {
+			delete(t.ids, id)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileSecretStore is a writable SecretStore persisted as JSON with mode 0600.
+// It keeps the current version and up to KeepVersions-1 previous ones so a
+// bad rotation can be rolled back. A deleted secret leaves a tombstone with
+// its last version number, so a re-created secret keeps counting upward and
+// versions held from before the delete stay stale. Reload picks up edits
+// made to the file by other processes.
+type FileSecretStore struct {
+	KeepVersions int
+
+	mu      sync.Mutex
+	path    string
+	secrets map[string][]storedSecretVersion // oldest first, last is current
+	stamp   fileStamp                        // of the file as last read or written
+	now     func() time.Time
+}
+
+// fileStamp identifies a version of a file cheaply
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statStamp(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+type storedSecretVersion struct {
+	Version   int        `json:"version"`
+	Value     string     `json:"value"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"` // tombstone, Value is empty
+}
+
+// NewFileSecretStore loads the store at path; a missing file is an empty store
+func NewFileSecretStore(path string, keepVersions int) (*FileSecretStore, error) {
+	f := &FileSecretStore{
+		KeepVersions: keepVersions,
+		path:         path,
+		secrets:      map[string][]storedSecretVersion{},
+		now:          time.Now,
+	}
+	secrets, stamp, err := readSecretsFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.secrets, f.stamp = secrets, stamp
+	return f, nil
+}
+
+func readSecretsFile(path string) (map[string][]storedSecretVersion, fileStamp, error) {
+	stamp, err := statStamp(path)
+	if err != nil {
+		return nil, fileStamp{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fileStamp{}, fmt.Errorf("reading secrets file: %w", err)
+	}
+	secrets := map[string][]storedSecretVersion{}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fileStamp{}, fmt.Errorf("parsing secrets file: %w", err)
+	}
+	return secrets, stamp, nil
+}
+
+func (f *FileSecretStore) Backend() string { return "file" }
+
+func (f *FileSecretStore) Get(name string) (Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current(name)
+}
+
+func (f *FileSecretStore) Names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.secrets))
+	for name := range f.secrets {
+		if f.live(name) != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Put creates the secret (expectedVersion 0) or stores a new version of it
+func (f *FileSecretStore) Put(name, value string, expectedVersion int) (Secret, error) {
+	return f.PutExpiring(name, value, time.Time{}, expectedVersion)
+}
+
+// PutExpiring is Put recording when the new value should be rotated by
+func (f *FileSecretStore) PutExpiring(name, value string, expiresAt time.Time, expectedVersion int) (Secret, error) {
+	if !ValidSecretName(name) {
+		return Secret{}, fmt.Errorf("invalid secret name %q", name)
+	}
+	if value == "" {
+		return Secret{}, errors.New("secret value must not be empty")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkVersion(name, expectedVersion); err != nil {
+		return Secret{}, err
+	}
+	return f.append(name, value, expiresAt)
+}
+
+// Rollback stores the value of a retained earlier version as a new version
+func (f *FileSecretStore) Rollback(name string, toVersion, expectedVersion int) (Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkVersion(name, expectedVersion); err != nil {
+		return Secret{}, err
+	}
+	for _, version := range f.live(name) {
+		if version.Version == toVersion {
+			var expiresAt time.Time
+			if version.ExpiresAt != nil {
+				expiresAt = *version.ExpiresAt
+			}
+			return f.append(name, version.Value, expiresAt)
+		}
+	}
+	return Secret{}, fmt.Errorf("version %d of %s is not retained: %w", toVersion, name, ErrSecretNotFound)
+}
+
+// Delete removes the secret's values, leaving a tombstone with its last
+// version number
+func (f *FileSecretStore) Delete(name string, expectedVersion int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	versions := f.live(name)
+	if versions == nil {
+		return ErrSecretNotFound
+	}
+	if err := f.checkVersion(name, expectedVersion); err != nil {
+		return err
+	}
+	f.secrets[name] = []storedSecretVersion{{
+		Version:   versions[len(versions)-1].Version,
+		CreatedAt: f.now().UTC(),
+		Deleted:   true,
+	}}
+	if err := f.save(); err != nil {
+		f.secrets[name] = versions
+		return err
+	}
+	return nil
+}
+
+// Reload rereads the file if it changed since it was last read or written.
+// A file that fails to parse leaves the current secrets in place.
+func (f *FileSecretStore) Reload() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stamp, err := statStamp(f.path)
+	if os.IsNotExist(err) && len(f.secrets) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checking secrets file: %w", err)
+	}
+	if stamp == f.stamp {
+		return nil, nil
+	}
+
+	secrets, stamp, err := readSecretsFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for name, versions := range secrets {
+		if !sameCurrentVersion(f.secrets[name], versions) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range f.secrets {
+		if _, ok := secrets[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	f.secrets, f.stamp = secrets, stamp
+	return changed, nil
+}
+
+func sameCurrentVersion(a, b []storedSecretVersion) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	x, y := a[len(a)-1], b[len(b)-1]
+	return x.Version == y.Version && x.Value == y.Value
+}
+
+// Versions lists the retained versions, newest first
+func (f *FileSecretStore) Versions(name string) ([]SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := f.live(name)
+	if stored == nil {
+		return nil, ErrSecretNotFound
+	}
+	versions := make([]SecretVersion, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		versions = append(versions, SecretVersion{Version: stored[i].Version, CreatedAt: stored[i].CreatedAt})
+	}
+	return versions, nil
+}
+
+// live returns the retained versions of a secret, or nil if it does not
+// exist or was deleted
+func (f *FileSecretStore) live(name string) []storedSecretVersion {
+	versions := f.secrets[name]
+	if len(versions) == 0 || versions[len(versions)-1].Deleted {
+		return nil
+	}
+	return versions
+}
+
+func (f *FileSecretStore) current(name string) (Secret, error) {
+	versions := f.live(name)
+	if versions == nil {
+		return Secret{}, ErrSecretNotFound
+	}
+	latest := versions[len(versions)-1]
+	secret := Secret{Name: name, Value: latest.Value, Version: latest.Version, UpdatedAt: latest.CreatedAt, Backend: f.Backend()}
+	if latest.ExpiresAt != nil {
+		secret.ExpiresAt = *latest.ExpiresAt
+	}
+	return secret, nil
+}
+
+func (f *FileSecretStore) checkVersion(name string, expected int) error {
+	current := 0
+	if versions := f.live(name); versions != nil {
+		current = versions[len(versions)-1].Version
+	}
+	if current != expected {
+		return &VersionConflictError{Expected: expected, Current: current}
+	}
+	return nil
+}
+
+// append adds a new current version, trims old ones and persists
+func (f *FileSecretStore) append(name, value string, expiresAt time.Time) (Secret, error) {
+	previous := f.secrets[name]
+	next := 1
+	if len(previous) > 0 {
+		next = previous[len(previous)-1].Version + 1
+	}
+
+	version := storedSecretVersion{
+		Version:   next,
+		Value:     value,
+		CreatedAt: f.now().UTC(),
+	}
+	if !expiresAt.IsZero() {
+		expiresAt = expiresAt.UTC()
+		version.ExpiresAt = &expiresAt
+	}
+	retained := f.live(name)
+	versions := append(append([]storedSecretVersion{}, retained...), version)
+	if keep := f.KeepVersions; keep > 0 && len(versions) > keep {
+		versions = versions[len(versions)-keep:]
+	}
+
+	f.secrets[name] = versions
+	if err := f.save(); err != nil {
+		if previous == nil {
+			delete(f.secrets, name)
+		} else {
+			f.secrets[name] = previous
+		}
+		return Secret{}, err
+	}
+	return f.current(name)
+}
+
+func (f *FileSecretStore) save() error {
+	data, err := json.MarshalIndent(f.secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+	f.stamp, _ = statStamp(f.path)
+	return nil
+}
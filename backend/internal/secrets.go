@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSecretNotFound  = errors.New("secret not found")
+	ErrVersionConflict = errors.New("secret version conflict")
+)
+
+// VersionConflictError reports the version a write expected and the one it found
+type VersionConflictError struct {
+	Expected, Current int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("expected version %d, current version is %d", e.Expected, e.Current)
+}
+
+func (e *VersionConflictError) Unwrap() error { return ErrVersionConflict }
+
+var secretNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// ValidSecretName reports whether name can be stored: lowercase letters,
+// digits, '.', '_' and '-', up to 64 characters
+func ValidSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+// Secret is the current value of a named secret
+type Secret struct {
+	Name      string
+	Value     string
+	Version   int
+	UpdatedAt time.Time
+	Backend   string
+	// ExpiresAt is when the value should be rotated by; zero if unknown
+	ExpiresAt time.Time
+}
+
+// SecretVersion describes one retained version, without its value
+type SecretVersion struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SecretStore is a source of named secrets
+type SecretStore interface {
+	// Backend names the store in metadata and audit entries, e.g. "env"
+	Backend() string
+	// Get returns ErrSecretNotFound for unknown or empty secrets
+	Get(name string) (Secret, error)
+	// Names lists the secrets the store holds
+	Names() []string
+}
+
+// WritableSecretStore is a SecretStore that can change its secrets. Every
+// write takes the version the caller last saw and fails with a
+// *VersionConflictError if the secret changed since; 0 means "must not exist".
+type WritableSecretStore interface {
+	SecretStore
+	Put(name, value string, expectedVersion int) (Secret, error)
+	// PutExpiring is Put with a rotation deadline recorded on the new version
+	PutExpiring(name, value string, expiresAt time.Time, expectedVersion int) (Secret, error)
+	Rollback(name string, toVersion, expectedVersion int) (Secret, error)
+	Delete(name string, expectedVersion int) error
+	Versions(name string) ([]SecretVersion, error)
+}
+
+// SecretStores looks secrets up in order, so an earlier store shadows a
+// later one holding the same name. Writes go to the first writable store.
+type SecretStores []SecretStore
+
+func (s SecretStores) Get(name string) (Secret, error) {
+	for _, store := range s {
+		secret, err := store.Get(name)
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		return secret, err
+	}
+	return Secret{}, ErrSecretNotFound
+}
+
+// Names lists the secrets of every store once, sorted
+func (s SecretStores) Names() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, store := range s {
+		for _, name := range store.Names() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Writable returns the store that receives writes, or nil if all are read-only
+func (s SecretStores) Writable() WritableSecretStore {
+	for _, store := range s {
+		if writable, ok := store.(WritableSecretStore); ok {
+			return writable
+		}
+	}
+	return nil
+}
+
+// ReloadableSecretStore is a SecretStore whose values can change outside
+// the process, e.g. an edited file. Reload returns the names that changed
+// and keeps serving the previous values if loading fails.
+type ReloadableSecretStore interface {
+	SecretStore
+	Reload() (changed []string, err error)
+}
+
+// Reload reloads every reloadable store and returns the names that changed
+func (s SecretStores) Reload() ([]string, error) {
+	var changed []string
+	var errs []error
+	for _, store := range s {
+		reloadable, ok := store.(ReloadableSecretStore)
+		if !ok {
+			continue
+		}
+		names, err := reloadable.Reload()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s store: %w", store.Backend(), err))
+		}
+		changed = append(changed, names...)
+	}
+	return changed, errors.Join(errs...)
+}
+
+// EnvSecretStore serves the secrets loaded from the environment and config
+// file. With a Source it reloads them when one of Files has been modified.
+type EnvSecretStore struct {
+	// Source reads the current values; nil makes the store static
+	Source func() (map[string]string, error)
+	// Files are checked for changes before calling Source
+	Files []string
+
+	mu       sync.RWMutex
+	secrets  map[string]Secret
+	loadedAt time.Time
+}
+
+func NewEnvSecretStore(values map[string]string) *EnvSecretStore {
+	e := &EnvSecretStore{secrets: map[string]Secret{}, loadedAt: time.Now()}
+	e.apply(values, e.loadedAt)
+	return e
+}
+
+func (e *EnvSecretStore) Backend() string { return "env" }
+
+func (e *EnvSecretStore) Get(name string) (Secret, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	secret, ok := e.secrets[name]
+	if !ok {
+		return Secret{}, ErrSecretNotFound
+	}
+	return secret, nil
+}
+
+func (e *EnvSecretStore) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.secrets))
+	for name := range e.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reload calls Source if any of Files changed since the last load. A changed
+// value gets the next version number.
+func (e *EnvSecretStore) Reload() ([]string, error) {
+	if e.Source == nil {
+		return nil, nil
+	}
+	e.mu.RLock()
+	since := e.loadedAt
+	e.mu.RUnlock()
+	if !modifiedSince(e.Files, since) {
+		return nil, nil
+	}
+
+	started := time.Now()
+	values, err := e.Source()
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.loadedAt = started
+	return e.apply(values, started), nil
+}
+
+// apply replaces the values and returns the names that were added, changed
+// or removed. The caller holds mu or owns e.
+func (e *EnvSecretStore) apply(values map[string]string, now time.Time) []string {
+	var changed []string
+	for name, value := range values {
+		old, ok := e.secrets[name]
+		switch {
+		case value == "" && ok:
+			delete(e.secrets, name)
+		case value == "" || (ok && old.Value == value):
+			continue
+		default:
+			e.secrets[name] = Secret{Name: name, Value: value, Version: old.Version + 1, UpdatedAt: now.UTC(), Backend: e.Backend()}
+		}
+		changed = append(changed, name)
+	}
+	for name := range e.secrets {
+		if _, ok := values[name]; !ok {
+			delete(e.secrets, name)
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// modifiedSince reports whether any existing file was modified after t
+func modifiedSince(files []string, t time.Time) bool {
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSecretStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	store, err := NewFileSecretStore(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Put("api", "v1", 0); err != nil {
+		t.Fatal(err)
+	}
+	var conflict *VersionConflictError
+	if _, err := store.Put("api", "again", 0); !errors.As(err, &conflict) || conflict.Current != 1 {
+		t.Fatalf("create over existing secret: err = %v", err)
+	}
+	for i, value := range []string{"v2", "v3", "v4"} {
+		if _, err := store.Put("api", value, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, _ := store.Versions("api")
+	if len(versions) != 3 || versions[0].Version != 4 || versions[2].Version != 2 {
+		t.Errorf("retained versions = %+v, want 4, 3, 2", versions)
+	}
+	if _, err := store.Rollback("api", 1, 4); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("rollback to trimmed version: err = %v", err)
+	}
+	secret, err := store.Rollback("api", 2, 4)
+	if err != nil || secret.Version != 5 || secret.Value != "v2" {
+		t.Fatalf("rollback = %+v, %v", secret, err)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("secrets file mode = %v, %v", info.Mode().Perm(), err)
+	}
+
+	// Reloading sees the persisted state
+	store, err = NewFileSecretStore(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret, _ := store.Get("api"); secret.Value != "v2" || secret.Version != 5 || secret.Backend != "file" {
+		t.Errorf("reloaded secret = %+v", secret)
+	}
+
+	if err := store.Delete("api", 4); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale delete: err = %v", err)
+	}
+	if err := store.Delete("api", 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("api"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("get after delete: err = %v", err)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), `"v2"`) || len(store.Names()) != 0 {
+		t.Errorf("deleted values kept: %s", data)
+	}
+
+	// Re-creating continues the version count, so versions from before the delete stay stale
+	store, _ = NewFileSecretStore(path, 3)
+	if _, err := store.Put("api", "stale", 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("write with a version from before the delete: err = %v", err)
+	}
+	if secret, err := store.Put("api", "v3", 0); err != nil || secret.Version != 6 {
+		t.Fatalf("re-create = %+v, %v", secret, err)
+	}
+	if versions, _ := store.Versions("api"); len(versions) != 1 || versions[0].Version != 6 {
+		t.Errorf("versions after re-create = %+v", versions)
+	}
+}
+
+func TestSecretStoresShadowing(t *testing.T) {
+	file, err := NewFileSecretStore(filepath.Join(t.TempDir(), "secrets.json"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := NewEnvSecretStore(map[string]string{"openai": "from-env", "firebase": ""})
+	stores := SecretStores{file, env}
+
+	if secret, _ := stores.Get("openai"); secret.Value != "from-env" || secret.Backend != "env" {
+		t.Errorf("before override: %+v", secret)
+	}
+	if _, err := stores.Get("firebase"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("empty env secret: err = %v", err)
+	}
+
+	stores.Writable().Put("openai", "from-file", 0)
+	if secret, _ := stores.Get("openai"); secret.Value != "from-file" || secret.Backend != "file" {
+		t.Errorf("after override: %+v", secret)
+	}
+	if (SecretStores{env}).Writable() != nil {
+		t.Error("env store should not be writable")
+	}
+}
+
+func TestFileSecretStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	store, err := NewFileSecretStore(path, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("openai", "sk-old", 0)
+	store.Put("firebase", "fb", 0)
+	if changed, err := store.Reload(); err != nil || len(changed) != 0 {
+		t.Errorf("reload after own writes = %v, %v; want no changes", changed, err)
+	}
+
+	// Another process rotates one key and removes the other
+	other, _ := NewFileSecretStore(path, 5)
+	other.Put("openai", "sk-new", 1)
+	other.Delete("firebase", 1)
+	changed, err := store.Reload()
+	if err != nil || strings.Join(changed, ",") != "firebase,openai" {
+		t.Fatalf("reload = %v, %v", changed, err)
+	}
+	if secret, _ := store.Get("openai"); secret.Value != "sk-new" || secret.Version != 2 {
+		t.Errorf("after reload: %+v", secret)
+	}
+
+	// A broken edit keeps the last good values
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	if _, err := store.Reload(); err == nil {
+		t.Error("expected an error for an unparsable file")
+	}
+	if secret, _ := store.Get("openai"); secret.Value != "sk-new" {
+		t.Errorf("after failed reload: %+v", secret)
+	}
+}
+
+func TestEnvSecretStoreReload(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(envFile, []byte("OPENAI_API_KEY=sk-old\n"), 0o600)
+
+	values := map[string]string{"openai": "sk-old", "firebase": "fb"}
+	loads := 0
+	store := NewEnvSecretStore(values)
+	store.Files = []string{envFile}
+	store.Source = func() (map[string]string, error) {
+		loads++
+		return values, nil
+	}
+
+	if changed, err := store.Reload(); err != nil || changed != nil || loads != 0 {
+		t.Fatalf("unmodified files: changed %v, err %v, %d loads", changed, err, loads)
+	}
+
+	values = map[string]string{"openai": "sk-new", "firebase": "fb"}
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(envFile, future, future)
+	changed, err := store.Reload()
+	if err != nil || strings.Join(changed, ",") != "openai" || loads != 1 {
+		t.Fatalf("modified file: changed %v, err %v, %d loads", changed, err, loads)
+	}
+	if secret, _ := store.Get("openai"); secret.Value != "sk-new" || secret.Version != 2 {
+		t.Errorf("after reload: %+v", secret)
+	}
+	if secret, _ := store.Get("firebase"); secret.Version != 1 {
+		t.Errorf("unchanged secret got a new version: %+v", secret)
+	}
+}
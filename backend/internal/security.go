@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SecurityHeaderOptions configures the headers added to every response
+type SecurityHeaderOptions struct {
+	HSTSMaxAgeSeconds     int // 0 disables Strict-Transport-Security
+	HSTSIncludeSubdomains bool
+	ContentSecurityPolicy string // empty disables the header
+}
+
+// ErrUnknownFields is returned by DecodeJSON when strict decoding sees an unexpected field
+var ErrUnknownFields = errors.New("request body contains unknown fields")
+
+// SecurityHeaders sets HSTS, CSP and the usual hardening headers on every response
+func SecurityHeaders(options SecurityHeaderOptions) func(http.Handler) http.Handler {
+	hsts := ""
+	if options.HSTSMaxAgeSeconds > 0 {
+		hsts = "max-age=" + strconv.Itoa(options.HSTSMaxAgeSeconds)
+		if options.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+			if hsts != "" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if options.ContentSecurityPolicy != "" {
+				h.Set("Content-Security-Policy", options.ContentSecurityPolicy)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NoStore keeps responses carrying secrets or tokens out of every cache
+func NoStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BodyLimit caps request bodies. routeLimits maps an exact request path to its
+// limit in bytes; other paths use defaultLimit.
+func BodyLimit(defaultLimit int64, routeLimits map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := defaultLimit
+			if routeLimit, ok := routeLimits[r.URL.Path]; ok {
+				limit = routeLimit
+			}
+			if limit <= 0 || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				log.Printf("Rejected %s %s: body of %d bytes exceeds limit of %d", r.Method, r.URL.Path, r.ContentLength, limit)
+				WriteError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", limit))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireJSON rejects POST, PUT and PATCH requests whose body is not
+// application/json. Requests without a body, such as a logout, pass.
+func RequireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength == 0 && len(r.TransferEncoding) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				log.Printf("Rejected %s %s: unsupported content type %q", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+				WriteError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DecodeJSON decodes a single JSON value from the request body. With strict set,
+// unknown fields are rejected with ErrUnknownFields.
+func DecodeJSON(r *http.Request, v interface{}, strict bool) error {
+	decoder := json.NewDecoder(r.Body)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		if strict && isUnknownFieldError(err) {
+			return fmt.Errorf("%w: %v", ErrUnknownFields, err)
+		}
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("request body must contain a single JSON object")
+	}
+	return nil
+}
+
+// WriteDecodeError responds to a DecodeJSON failure with 413 or 400
+func WriteDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", maxBytesErr.Limit))
+		return
+	}
+	if errors.Is(err, ErrUnknownFields) {
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Request body contains unknown fields")
+		return
+	}
+	WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+}
+
+func isUnknownFieldError(err error) bool {
+	// encoding/json has no typed error for DisallowUnknownFields
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimitAndRequireJSON(t *testing.T) {
+	var decodeErr error
+	handler := BodyLimit(64, map[string]int64{"/api/chat": 16})(RequireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		decodeErr = DecodeJSON(r, &req, true)
+		if decodeErr != nil {
+			WriteDecodeError(w, r, decodeErr)
+		}
+	})))
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"accepted", "/api/chat", "application/json; charset=utf-8", `{"message":"hi"}`, http.StatusOK},
+		{"route limit", "/api/chat", "application/json", `{"message":"hello there"}`, http.StatusRequestEntityTooLarge},
+		{"default limit", "/auth", "application/json", `{"message":"hello there"}`, http.StatusOK},
+		{"wrong content type", "/api/chat", "text/plain", `{"message":"hi"}`, http.StatusUnsupportedMediaType},
+		{"unknown field", "/auth", "application/json", `{"message":"hi","role":"system"}`, http.StatusBadRequest},
+		{"trailing data", "/auth", "application/json", `{"message":"hi"}{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.want {
+				t.Errorf("status = %d, want %d (decode error: %v)", rr.Code, tt.want, decodeErr)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/auth", strings.NewReader(`{"message":"hi","role":"system"}`))
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !errors.Is(decodeErr, ErrUnknownFields) {
+		t.Errorf("expected ErrUnknownFields, got %v", decodeErr)
+	}
+
+	rr := httptest.NewRecorder()
+	RequireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, httptest.NewRequest("POST", "/auth/logout", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("bodyless POST: status = %d, want 200", rr.Code)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := SecurityHeaders(SecurityHeaderOptions{
+		HSTSMaxAgeSeconds:     600,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'none'",
+	})(NoStore(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/secrets/openai", nil))
+
+	want := map[string]string{
+		"Strict-Transport-Security": "max-age=600; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"Content-Security-Policy":   "default-src 'none'",
+		"Cache-Control":             "no-store",
+	}
+	for header, value := range want {
+		if got := rr.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+}
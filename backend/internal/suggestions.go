@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Suggestion is a starter question for the chat UI
+type Suggestion struct {
+	Text string `json:"text"`
+	// Kind is curated, role, project or technology
+	Kind      string `json:"kind"`
+	SectionID string `json:"section_id,omitempty"`
+}
+
+type SuggestionsResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// DefaultChatSuggestions are listed before the questions derived from the work history
+var DefaultChatSuggestions = []string{
+	"What does Ethan do?",
+	"What Go experience does Ethan have?",
+	"Which AWS services has Ethan worked with?",
+	"What is Ethan working on now?",
+}
+
+const (
+	defaultSuggestionLimit = 10
+	maxSuggestionLimit     = 50
+	maxFollowUps           = 3
+)
+
+// DeriveSuggestions turns work history sections into questions: one per role
+// and project, then one per technology, most widely used first
+func DeriveSuggestions(sections []WorkSection) []Suggestion {
+	var suggestions []Suggestion
+	usage := map[string]int{}
+	for _, section := range sections {
+		switch {
+		case section.Kind == "project":
+			suggestions = append(suggestions, Suggestion{Text: "Tell me about the " + section.Title + " project.", Kind: "project", SectionID: section.ID})
+		case strings.Contains(section.Title, " at "):
+			suggestions = append(suggestions, Suggestion{Text: "What did Ethan do as " + section.Title + "?", Kind: "role", SectionID: section.ID})
+		default:
+			suggestions = append(suggestions, Suggestion{Text: "Tell me about " + section.Title + ".", Kind: "role", SectionID: section.ID})
+		}
+		for _, tech := range section.Technologies {
+			usage[tech]++
+		}
+	}
+
+	technologies := make([]string, 0, len(usage))
+	for tech := range usage {
+		technologies = append(technologies, tech)
+	}
+	sort.Slice(technologies, func(i, j int) bool {
+		if usage[technologies[i]] != usage[technologies[j]] {
+			return usage[technologies[i]] > usage[technologies[j]]
+		}
+		return technologies[i] < technologies[j]
+	})
+	for _, tech := range technologies {
+		suggestions = append(suggestions, Suggestion{Text: "How has Ethan used " + tech + "?", Kind: "technology"})
+	}
+	return suggestions
+}
+
+// curatedSuggestions returns the configured starter questions, or the defaults
+func (s *ChatService) curatedSuggestions() []string {
+	if len(s.Suggestions) > 0 {
+		return s.Suggestions
+	}
+	return DefaultChatSuggestions
+}
+
+// SuggestionsHandler lists starter questions: the curated ones first, then
+// questions derived from the work history. ?kind= filters and ?limit= caps the list.
+func (s *ChatService) SuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultSuggestionLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSuggestionLimit {
+			WriteError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be between 1 and "+strconv.Itoa(maxSuggestionLimit))
+			return
+		}
+		limit = parsed
+	}
+	kind := r.URL.Query().Get("kind")
+
+	var suggestions []Suggestion
+	for _, text := range s.curatedSuggestions() {
+		suggestions = append(suggestions, Suggestion{Text: text, Kind: "curated"})
+	}
+	suggestions = append(suggestions, DeriveSuggestions(WorkHistory())...)
+
+	response := SuggestionsResponse{Suggestions: []Suggestion{}}
+	for _, suggestion := range suggestions {
+		if len(response.Suggestions) == limit {
+			break
+		}
+		if kind == "" || suggestion.Kind == kind {
+			response.Suggestions = append(response.Suggestions, suggestion)
+		}
+	}
+	log.Printf("Served %d chat suggestions", len(response.Suggestions))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// FollowUpSuggestions proposes up to three next questions from what an answer
+// mentions: technologies and projects of the work history the visitor has not
+// asked about yet, then curated questions
+func (s *ChatService) FollowUpSuggestions(question, answer string) []string {
+	asked := NormalizeQuestion(question)
+	var followUps []string
+	add := func(text string) {
+		if len(followUps) < maxFollowUps && NormalizeQuestion(text) != asked && !contains(followUps, text) {
+			followUps = append(followUps, text)
+		}
+	}
+
+	inHistory := map[string]bool{}
+	for _, section := range WorkHistory() {
+		for _, tech := range section.Technologies {
+			inHistory[tech] = true
+		}
+	}
+	askedTechnologies := MentionedTechnologies(question)
+	for _, tech := range MentionedTechnologies(answer) {
+		if inHistory[tech] && !contains(askedTechnologies, tech) {
+			add("How has Ethan used " + tech + "?")
+		}
+	}
+	lowerAnswer, lowerQuestion := strings.ToLower(answer), strings.ToLower(question)
+	for _, section := range WorkHistory() {
+		title := strings.ToLower(section.Title)
+		if section.Kind == "project" && strings.Contains(lowerAnswer, title) && !strings.Contains(lowerQuestion, title) {
+			add("Tell me about the " + section.Title + " project.")
+		}
+	}
+	for _, text := range s.curatedSuggestions() {
+		add(text)
+	}
+	return followUps
+}
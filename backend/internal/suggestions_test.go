@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const sampleWorkHistory = `Pre-Prompt
+Only use the text below.
+
+### Engineer at Acme
+
+#### Billing Rewrite
+
+_May 2023 - Present_
+Rewrote billing in GoLang on AWS Lambdas. Time to go home.
+
+#### Search
+
+Built search with React.
+
+---
+
+## Mentoring Program
+
+Taught React to new hires.
+`
+
+func TestParseWorkHistory(t *testing.T) {
+	sections := ParseWorkHistory(sampleWorkHistory)
+	var ids []string
+	for _, section := range sections {
+		ids = append(ids, section.ID)
+	}
+	if want := []string{"engineer-at-acme", "billing-rewrite", "search", "mentoring-program"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+
+	billing := sections[1]
+	if billing.Kind != "project" || billing.RoleID != "engineer-at-acme" || billing.Dates != "May 2023 - Present" {
+		t.Errorf("billing = %+v", billing)
+	}
+	if want := []string{"AWS", "AWS Lambda", "Go"}; !reflect.DeepEqual(billing.Technologies, want) {
+		t.Errorf("billing technologies = %v, want %v", billing.Technologies, want)
+	}
+	if sections[3].Kind != "role" || sections[3].RoleID != "" {
+		t.Errorf("standalone entry = %+v", sections[3])
+	}
+	if got := MentionedTechnologies("Let's go to lunch"); len(got) != 0 {
+		t.Errorf("lowercase go matched %v", got)
+	}
+}
+
+func TestDeriveSuggestions(t *testing.T) {
+	suggestions := DeriveSuggestions(ParseWorkHistory(sampleWorkHistory))
+	want := []Suggestion{
+		{Text: "What did Ethan do as Engineer at Acme?", Kind: "role", SectionID: "engineer-at-acme"},
+		{Text: "Tell me about the Billing Rewrite project.", Kind: "project", SectionID: "billing-rewrite"},
+		{Text: "Tell me about the Search project.", Kind: "project", SectionID: "search"},
+		{Text: "Tell me about Mentoring Program.", Kind: "role", SectionID: "mentoring-program"},
+		{Text: "How has Ethan used React?", Kind: "technology"},
+		{Text: "How has Ethan used AWS?", Kind: "technology"},
+		{Text: "How has Ethan used AWS Lambda?", Kind: "technology"},
+		{Text: "How has Ethan used Go?", Kind: "technology"},
+	}
+	if !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("suggestions = %+v", suggestions)
+	}
+}
+
+func TestSuggestionsHandler(t *testing.T) {
+	service := NewChatService("")
+	service.Suggestions = []string{"Why hire Ethan?"}
+
+	get := func(query string) (*httptest.ResponseRecorder, SuggestionsResponse) {
+		rr := httptest.NewRecorder()
+		service.SuggestionsHandler(rr, httptest.NewRequest("GET", "/api/chat/suggestions"+query, nil))
+		var response SuggestionsResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	_, response := get("?limit=3")
+	if len(response.Suggestions) != 3 || response.Suggestions[0] != (Suggestion{Text: "Why hire Ethan?", Kind: "curated"}) {
+		t.Errorf("suggestions = %+v", response.Suggestions)
+	}
+	_, response = get("?kind=technology&limit=50")
+	for _, suggestion := range response.Suggestions {
+		if suggestion.Kind != "technology" {
+			t.Errorf("kind filter let through %+v", suggestion)
+		}
+	}
+	if len(response.Suggestions) == 0 {
+		t.Error("no technology suggestions derived from the work history")
+	}
+	if rr, _ := get("?limit=500"); rr.Code != http.StatusBadRequest {
+		t.Errorf("limit=500: status = %d, want 400", rr.Code)
+	}
+}
+
+func TestFollowUpSuggestions(t *testing.T) {
+	service := NewChatService("")
+	service.Suggestions = []string{"What does Ethan do?"}
+
+	followUps := service.FollowUpSuggestions("What Go experience does Ethan have?",
+		"Ethan used Go and PostgreSQL on the Core Banking Platform Development project.")
+	want := []string{"How has Ethan used PostgreSQL?", "Tell me about the Core Banking Platform Development project.", "What does Ethan do?"}
+	if !reflect.DeepEqual(followUps, want) {
+		t.Errorf("follow-ups = %v, want %v", followUps, want)
+	}
+
+	if followUps := service.FollowUpSuggestions("What does Ethan do?", "He consults."); len(followUps) != 0 {
+		t.Errorf("repeated the question as a follow-up: %v", followUps)
+	}
+}
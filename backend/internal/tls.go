@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate/key pair from disk and picks up
+// replacements (e.g. certbot renewals) without a restart. The files are
+// checked for changes at most once per CheckInterval, during a handshake.
+type CertReloader struct {
+	CertFile      string
+	KeyFile       string
+	CheckInterval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // newest modification time of the loaded pair
+	lastCheck time.Time
+	now       func() time.Time
+}
+
+// NewCertReloader loads the pair once and fails if it is unusable
+func NewCertReloader(certFile, keyFile string, checkInterval time.Duration) (*CertReloader, error) {
+	c := &CertReloader{
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CheckInterval: checkInterval,
+		now:           time.Now,
+	}
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.load(modTime); err != nil {
+		return nil, err
+	}
+	c.lastCheck = c.now()
+	return c, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastCheck) >= c.CheckInterval {
+		c.lastCheck = now
+		c.reloadIfChanged()
+	}
+	return c.cert, nil
+}
+
+// reloadIfChanged swaps in the pair on disk when either file changed. A pair
+// that fails to load (e.g. cert written but key not yet) keeps the old one
+// serving and is retried on the next check.
+func (c *CertReloader) reloadIfChanged() {
+	modTime, err := c.filesModTime()
+	if err != nil {
+		log.Printf("TLS certificate check failed, keeping current certificate: %v", err)
+		return
+	}
+	if modTime.Equal(c.modTime) {
+		return
+	}
+	if err := c.load(modTime); err != nil {
+		log.Printf("TLS certificate reload failed, keeping current certificate: %v", err)
+		return
+	}
+	log.Printf("Reloaded TLS certificate from %s", c.CertFile)
+}
+
+func (c *CertReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS key pair: %w", err)
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+func (c *CertReloader) filesModTime() (time.Time, error) {
+	var newest time.Time
+	for _, path := range []string{c.CertFile, c.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// ParseTLSVersion accepts "1.2" or "1.3"; older versions are refused
+func ParseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+	case "1.2", "":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q (use 1.2 or 1.3)", version)
+}
+
+// ParseCipherSuites maps Go cipher suite names (e.g.
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256) to IDs. Suites Go considers
+// insecure are refused. They only apply to TLS 1.2; 1.3 suites are fixed.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	var ids []uint16
+	var errs []error
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown or insecure cipher suite %q", name))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.Join(errs...)
+}
+
+// LoadClientCAs reads a PEM bundle of CAs trusted to sign client certificates
+func LoadClientCAs(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// RequireClientCert rejects requests that did not present a client
+// certificate verified against the configured CAs (mTLS for admin routes)
+func RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			log.Printf("Rejected %s %s from %s: no verified client certificate", r.Method, r.URL.Path, r.RemoteAddr)
+			WriteError(w, r, http.StatusForbidden, CodeClientCertRequired, "A verified client certificate is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RedirectToHTTPS answers plain HTTP requests with a permanent redirect to
+// the same host and path on httpsPort
+func RedirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// 308 keeps the method and body for non-GET requests
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
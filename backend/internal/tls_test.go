@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedPair writes a throwaway certificate for commonName to dir
+func writeSelfSignedPair(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func servedCommonName(t *testing.T, reloader *CertReloader) string {
+	t.Helper()
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderPicksUpNewPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedPair(t, dir, "old.example")
+
+	reloader, err := NewCertReloader(certFile, keyFile, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	writeSelfSignedPair(t, dir, "new.example")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	if got := servedCommonName(t, reloader); got != "old.example" {
+		t.Errorf("reloaded before the check interval: serving %s", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := servedCommonName(t, reloader); got != "new.example" {
+		t.Errorf("serving %s after rotation, want new.example", got)
+	}
+
+	// A broken pair keeps the current certificate
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	broken := later.Add(time.Second)
+	os.Chtimes(keyFile, broken, broken)
+	now = now.Add(time.Minute)
+	if got := servedCommonName(t, reloader); got != "new.example" {
+		t.Errorf("serving %s after a bad rotation, want new.example", got)
+	}
+}
+
+func TestParseTLSSettings(t *testing.T) {
+	if version, err := ParseTLSVersion("1.3"); err != nil || version != tls.VersionTLS13 {
+		t.Errorf("ParseTLSVersion(1.3) = %v, %v", version, err)
+	}
+	if _, err := ParseTLSVersion("1.0"); err == nil {
+		t.Error("expected TLS 1.0 to be refused")
+	}
+
+	suites, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+	if err != nil || len(suites) != 1 || suites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("ParseCipherSuites = %v, %v", suites, err)
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("expected an insecure cipher suite to be refused")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		method, host, port, want string
+		status                   int
+	}{
+		{"GET", "example.com", "443", "https://example.com/api/v1/chat?x=1", http.StatusMovedPermanently},
+		{"GET", "example.com:8080", "8443", "https://example.com:8443/api/v1/chat?x=1", http.StatusMovedPermanently},
+		{"POST", "[::1]:80", "443", "https://[::1]/api/v1/chat?x=1", http.StatusPermanentRedirect},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/chat?x=1", nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		RedirectToHTTPS(tt.port).ServeHTTP(rr, req)
+		if rr.Code != tt.status || rr.Header().Get("Location") != tt.want {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.host, rr.Code, rr.Header().Get("Location"), tt.status, tt.want)
+		}
+	}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	handler := RequireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/admin/usage", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("without a client certificate: status = %d, want 403", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/usage", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("with a verified client certificate: status = %d, want 200", rr.Code)
+	}
+}
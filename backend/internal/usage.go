@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelPrice is the OpenAI list price in USD per 1K tokens
+type ModelPrice struct {
+	PromptPer1K     float64 `json:"prompt_per_1k" yaml:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k" yaml:"completion_per_1k"`
+}
+
+// ModelPrices maps a model name to its price. It can be set from an env var
+// in the ParseModelPrices format.
+type ModelPrices map[string]ModelPrice
+
+func (p *ModelPrices) UnmarshalText(text []byte) error {
+	parsed, err := ParseModelPrices(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// DefaultModelPrices is used when no price table is configured
+var DefaultModelPrices = ModelPrices{
+	"gpt-3.5-turbo": {PromptPer1K: 0.0005, CompletionPer1K: 0.0015},
+	"gpt-4o-mini":   {PromptPer1K: 0.00015, CompletionPer1K: 0.0006},
+	"gpt-4o":        {PromptPer1K: 0.0025, CompletionPer1K: 0.01},
+}
+
+// UsageTotals aggregates token usage and cost over a period
+type UsageTotals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// UsageRecord is the accounting for a single OpenAI call
+type UsageRecord struct {
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// UsageReport is returned by the admin usage endpoint
+type UsageReport struct {
+	Today          UsageTotals            `json:"today"`
+	Last30Days     UsageTotals            `json:"last_30_days"`
+	Month          UsageTotals            `json:"month"`
+	Daily          map[string]UsageTotals `json:"daily"`
+	DailyBudget    float64                `json:"daily_budget_usd"`
+	MonthlyBudget  float64                `json:"monthly_budget_usd"`
+	FallbackActive bool                   `json:"fallback_active"`
+	FallbackReason string                 `json:"fallback_reason,omitempty"`
+	Prices         ModelPrices            `json:"prices"`
+}
+
+type usageState struct {
+	Daily   map[string]*UsageTotals `json:"daily"`   // keyed by 2006-01-02 (UTC)
+	Monthly map[string]*UsageTotals `json:"monthly"` // keyed by 2006-01 (UTC)
+}
+
+// UsageTracker records token usage per request, keeps rolling daily and
+// monthly totals on disk and enforces the configured budget caps.
+type UsageTracker struct {
+	Prices        ModelPrices
+	DailyBudget   float64 // USD, 0 disables the cap
+	MonthlyBudget float64 // USD, 0 disables the cap
+
+	mu    sync.Mutex
+	path  string
+	state usageState
+	now   func() time.Time
+}
+
+// NewUsageTracker loads previously persisted totals from path, if present
+func NewUsageTracker(path string, prices ModelPrices, dailyBudget, monthlyBudget float64) (*UsageTracker, error) {
+	if len(prices) == 0 {
+		prices = DefaultModelPrices
+	}
+
+	t := &UsageTracker{
+		Prices:        prices,
+		DailyBudget:   dailyBudget,
+		MonthlyBudget: monthlyBudget,
+		path:          path,
+		state:         usageState{Daily: map[string]*UsageTotals{}, Monthly: map[string]*UsageTotals{}},
+		now:           time.Now,
+	}
+
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading usage file: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		return nil, fmt.Errorf("parsing usage file: %w", err)
+	}
+	if t.state.Daily == nil {
+		t.state.Daily = map[string]*UsageTotals{}
+	}
+	if t.state.Monthly == nil {
+		t.state.Monthly = map[string]*UsageTotals{}
+	}
+	return t, nil
+}
+
+// Record adds one request's usage to the running totals and persists them
+func (t *UsageTracker) Record(model string, promptTokens, completionTokens int) UsageRecord {
+	record := UsageRecord{
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		CostUSD:          t.cost(model, promptTokens, completionTokens),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	for _, totals := range []*UsageTotals{
+		t.bucket(t.state.Daily, now.Format("2006-01-02")),
+		t.bucket(t.state.Monthly, now.Format("2006-01")),
+	} {
+		totals.Requests++
+		totals.PromptTokens += promptTokens
+		totals.CompletionTokens += completionTokens
+		totals.CostUSD += record.CostUSD
+	}
+	t.prune(now)
+
+	if err := t.save(); err != nil {
+		log.Printf("Failed to persist usage totals: %v", err)
+	}
+	return record
+}
+
+// BudgetExceeded reports whether a budget cap has been reached and which one
+func (t *UsageTracker) BudgetExceeded() (bool, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.budgetExceeded(t.now().UTC())
+}
+
+// Report summarizes spend for the admin endpoint
+func (t *UsageTracker) Report() UsageReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now().UTC()
+	report := UsageReport{
+		Daily:         map[string]UsageTotals{},
+		DailyBudget:   t.DailyBudget,
+		MonthlyBudget: t.MonthlyBudget,
+		Prices:        t.Prices,
+	}
+	if today, ok := t.state.Daily[now.Format("2006-01-02")]; ok {
+		report.Today = *today
+	}
+	if month, ok := t.state.Monthly[now.Format("2006-01")]; ok {
+		report.Month = *month
+	}
+
+	cutoff := now.AddDate(0, 0, -29).Format("2006-01-02")
+	for day, totals := range t.state.Daily {
+		report.Daily[day] = *totals
+		if day >= cutoff {
+			report.Last30Days.Requests += totals.Requests
+			report.Last30Days.PromptTokens += totals.PromptTokens
+			report.Last30Days.CompletionTokens += totals.CompletionTokens
+			report.Last30Days.CostUSD += totals.CostUSD
+		}
+	}
+
+	report.FallbackActive, report.FallbackReason = t.budgetExceeded(now)
+	return report
+}
+
+// ReportHandler serves the usage report as JSON. It is only registered on the
+// admin listener; the public API is reachable with the frontend's shared
+// credentials, so it never serves spend.
+func (t *UsageTracker) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Usage report requested from %s", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.Report())
+}
+
+func (t *UsageTracker) cost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := t.Prices[model]
+	if !ok {
+		// OpenAI reports dated snapshots (gpt-4o-2024-08-06), price them as the base model
+		longest := ""
+		for name := range t.Prices {
+			if strings.HasPrefix(model, name) && len(name) > len(longest) {
+				longest = name
+			}
+		}
+		if longest == "" {
+			log.Printf("No price configured for model %s, recording zero cost", model)
+			return 0
+		}
+		price = t.Prices[longest]
+	}
+	return float64(promptTokens)/1000*price.PromptPer1K + float64(completionTokens)/1000*price.CompletionPer1K
+}
+
+func (t *UsageTracker) budgetExceeded(now time.Time) (bool, string) {
+	if t.DailyBudget > 0 {
+		if today, ok := t.state.Daily[now.Format("2006-01-02")]; ok && today.CostUSD >= t.DailyBudget {
+			return true, fmt.Sprintf("daily budget of $%.2f reached", t.DailyBudget)
+		}
+	}
+	if t.MonthlyBudget > 0 {
+		if month, ok := t.state.Monthly[now.Format("2006-01")]; ok && month.CostUSD >= t.MonthlyBudget {
+			return true, fmt.Sprintf("monthly budget of $%.2f reached", t.MonthlyBudget)
+		}
+	}
+	return false, ""
+}
+
+func (t *UsageTracker) bucket(periods map[string]*UsageTotals, key string) *UsageTotals {
+	totals, ok := periods[key]
+	if !ok {
+		totals = &UsageTotals{}
+		periods[key] = totals
+	}
+	return totals
+}
+
+// prune keeps 90 days of daily totals and 24 months of monthly totals
+func (t *UsageTracker) prune(now time.Time) {
+	dayCutoff := now.AddDate(0, 0, -90).Format("2006-01-02")
+	for day := range t.state.Daily {
+		if day < dayCutoff {
+			delete(t.state.Daily, day)
+		}
+	}
+	months := make([]string, 0, len(t.state.Monthly))
+	for month := range t.state.Monthly {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	for len(months) > 24 {
+		delete(t.state.Monthly, months[0])
+		months = months[1:]
+	}
+}
+
+// save writes the totals atomically so a crash never leaves a truncated file
+func (t *UsageTracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// ParseModelPrices parses a price table of the form
+// "gpt-4o=0.0025:0.01,gpt-4o-mini=0.00015:0.0006" (prompt:completion USD per 1K tokens)
+func ParseModelPrices(spec string) (ModelPrices, error) {
+	prices := ModelPrices{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, rates, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("price entry %q must be model=prompt:completion", entry)
+		}
+		promptRate, completionRate, ok := strings.Cut(rates, ":")
+		if !ok {
+			return nil, fmt.Errorf("price entry %q must be model=prompt:completion", entry)
+		}
+		prompt, err := strconv.ParseFloat(promptRate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("price entry %q: %w", entry, err)
+		}
+		completion, err := strconv.ParseFloat(completionRate, 64)
+		if err != nil {
+			return nil, fmt.Errorf("price entry %q: %w", entry, err)
+		}
+		prices[strings.TrimSpace(model)] = ModelPrice{PromptPer1K: prompt, CompletionPer1K: completion}
+	}
+	return prices, nil
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WorkSection is one role or project of the work history. IDs are slugs of
+// the heading, stable as long as the heading text is, so the frontend can
+// link them to resume entries.
+type WorkSection struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Kind is "role" for a position or standalone entry and "project" for work within a role
+	Kind string `json:"kind"`
+	// RoleID is the enclosing role of a project
+	RoleID       string   `json:"role_id,omitempty"`
+	Dates        string   `json:"dates,omitempty"`
+	Technologies []string `json:"technologies,omitempty"`
+	Text         string   `json:"-"`
+}
+
+// Technology is a name the work history may mention, with its spellings
+type Technology struct {
+	Name    string
+	Aliases []string
+}
+
+// KnownTechnologies lists the technologies recognised in the work history and
+// in chat answers. Aliases match case-sensitively, as whole words, so "Go"
+// does not match "go to"; list every spelling the work history uses.
+var KnownTechnologies = []Technology{
+	{"Go", []string{"Go", "GoLang", "Golang"}},
+	{"Python", []string{"Python", "python"}},
+	{"Java", []string{"Java", "java"}},
+	{"Spring Boot", []string{"Spring Boot", "springboot"}},
+	{"JavaScript", []string{"JavaScript"}},
+	{"TypeScript", []string{"TypeScript"}},
+	{"React", []string{"React"}},
+	{"Redux", []string{"Redux"}},
+	{"NX", []string{"NX"}},
+	{"SASS", []string{"SASS", "Sass"}},
+	{"Jest", []string{"Jest"}},
+	{"Mapbox", []string{"Mapbox", "mapbox"}},
+	{"Figma", []string{"Figma"}},
+	{"AWS", []string{"AWS"}},
+	{"AWS Step Functions", []string{"Step Functions", "step functions"}},
+	{"AWS Lambda", []string{"Lambda", "Lambdas", "lambdas"}},
+	{"AWS Glue", []string{"Glue", "glue"}},
+	{"AWS Fargate", []string{"Fargate"}},
+	{"Amazon ECS", []string{"ECS", "Elastic Container Service"}},
+	{"AWS Secrets Manager", []string{"Secrets Manager"}},
+	{"AWS Batch", []string{"AWS Batch"}},
+	{"Aurora", []string{"Aurora"}},
+	{"PostgreSQL", []string{"Postgres", "PostgreSQL"}},
+	{"CloudWatch", []string{"CloudWatch", "Cloudwatch"}},
+	{"SNS", []string{"SNS"}},
+	{"SQS", []string{"SQS"}},
+	{"PagerDuty", []string{"PagerDuty", "Pagerduty"}},
+	{"PactFlow", []string{"PactFlow"}},
+	{"Behave", []string{"Behave"}},
+	{"JUnit", []string{"JUnit"}},
+	{"PowerApps", []string{"PowerApps", "Power Apps"}},
+	{"Power Automate", []string{"PowerAutomate", "Power Automate"}},
+	{"Power BI", []string{"PowerBI", "Power BI"}},
+	{"Selenium", []string{"Selenium"}},
+	{"SQL", []string{"SQL"}},
+	{"Microsoft Access", []string{"Microsoft Access"}},
+	{"Excel", []string{"Excel"}},
+	{"VBA", []string{"VBA"}},
+	// Common technologies absent from the work history, so answers naming them can be caught
+	{"Kubernetes", []string{"Kubernetes", "k8s"}},
+	{"Docker", []string{"Docker"}},
+	{"Rust", []string{"Rust"}},
+	{"C#", []string{"C#", ".NET"}},
+	{"Ruby", []string{"Ruby", "Rails"}},
+	{"Angular", []string{"Angular"}},
+	{"Vue", []string{"Vue", "Vue.js"}},
+	{"Node.js", []string{"Node.js", "NodeJS"}},
+	{"Azure", []string{"Azure"}},
+	{"Google Cloud", []string{"GCP", "Google Cloud"}},
+	{"Terraform", []string{"Terraform"}},
+	{"Kafka", []string{"Kafka"}},
+	{"MongoDB", []string{"MongoDB"}},
+	{"GraphQL", []string{"GraphQL"}},
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{2,4})\s+(.+?)\s*$`)
+	datesPattern   = regexp.MustCompile(`^_([A-Z][a-z]+ \d{4} - (?:Present|[A-Z][a-z]+ \d{4}))_$`)
+	slugPattern    = regexp.MustCompile(`[^a-z0-9]+`)
+
+	technologyPatterns = sync.OnceValue(func() map[string]*regexp.Regexp {
+		patterns := map[string]*regexp.Regexp{}
+		for _, tech := range KnownTechnologies {
+			var alternatives []string
+			for _, alias := range tech.Aliases {
+				alternatives = append(alternatives, regexp.QuoteMeta(alias))
+			}
+			patterns[tech.Name] = regexp.MustCompile(`(?:^|[^\w.#])(?:` + strings.Join(alternatives, "|") + `)(?:$|[^\w#])`)
+		}
+		return patterns
+	})
+)
+
+// WorkHistory is the parsed form of WorkHistoryPrompt
+var WorkHistory = sync.OnceValue(func() []WorkSection {
+	return ParseWorkHistory(WorkHistoryPrompt)
+})
+
+// ParseWorkHistory splits the markdown work history into sections. "##" and
+// "###" headings start a role; "####" headings start a project within it.
+// Text before the first heading is not part of any section.
+func ParseWorkHistory(markdown string) []WorkSection {
+	var sections []WorkSection
+	var body []string
+	seen := map[string]int{}
+	roleID := ""
+
+	flush := func() {
+		if len(sections) == 0 {
+			return
+		}
+		section := &sections[len(sections)-1]
+		section.Text = strings.TrimSpace(strings.Join(body, "\n"))
+		section.Technologies = MentionedTechnologies(section.Title + "\n" + section.Text)
+		body = nil
+	}
+	for _, line := range strings.Split(markdown, "\n") {
+		match := headingPattern.FindStringSubmatch(line)
+		if match == nil {
+			if dates := datesPattern.FindStringSubmatch(strings.TrimSpace(line)); dates != nil && len(sections) > 0 && sections[len(sections)-1].Dates == "" {
+				sections[len(sections)-1].Dates = dates[1]
+				continue
+			}
+			if strings.TrimSpace(line) != "---" {
+				body = append(body, line)
+			}
+			continue
+		}
+		flush()
+		title := strings.TrimSuffix(match[2], ":")
+		id := slugPattern.ReplaceAllString(strings.ToLower(title), "-")
+		id = strings.Trim(id, "-")
+		if seen[id]++; seen[id] > 1 {
+			id += "-" + strconv.Itoa(seen[id])
+		}
+		section := WorkSection{ID: id, Title: title, Kind: "role"}
+		if len(match[1]) == 4 && roleID != "" {
+			section.Kind, section.RoleID = "project", roleID
+		} else {
+			roleID = id
+		}
+		sections = append(sections, section)
+	}
+	flush()
+	return sections
+}
+
+// MentionedTechnologies returns the known technologies named in text, sorted
+func MentionedTechnologies(text string) []string {
+	var names []string
+	for name, pattern := range technologyPatterns() {
+		if pattern.MatchString(text) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WorkSectionByID looks up a section of the parsed work history
+func WorkSectionByID(id string) (WorkSection, bool) {
+	for _, section := range WorkHistory() {
+		if section.ID == id {
+			return section, true
+		}
+	}
+	return WorkSection{}, false
+}
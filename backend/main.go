@@ -1,41 +1,49 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	"github.com/rs/cors"
 
 	"portfolio-secrets-service/internal"
 )
 
-// Config holds all configuration
-type Config struct {
-	JWTSecret      string
-	Port           string
-	AllowedOrigins string
-	AuthUsername   string
-	AuthPassword   string
-	OpenAIKey      string
-	FirebaseKey    string
-	// Add more API keys as needed
-}
-
 // SecretService handles secret operations
 type SecretService struct {
-	config *Config
+	config      *Config
+	chat        *internal.ChatService
+	usage       *internal.UsageTracker
+	rateLimiter *internal.RateLimiter
+	metrics     *internal.Metrics
+	revocations *internal.TokenRevocations
+	auditLog    *internal.AuditLog
+	secrets     internal.SecretStores
+	policies    *internal.SecretPolicyEngine
+	apiKeys     *internal.APIKeyStore
+	oidc        *internal.OIDCProvider // nil unless OIDC login is configured
 }
 
+// tokenLifetime is how long an issued JWT stays valid
+const tokenLifetime = 24 * time.Hour
+
 // Claims for JWT
 type Claims struct {
-	Username string `json:"username"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -45,108 +53,240 @@ type AuthRequest struct {
 	Password string `json:"password"`
 }
 
-// AuthResponse for login
+// AuthResponse for login. With cookie sessions the token is only set as an
+// HttpOnly cookie and CSRFToken is returned instead.
 type AuthResponse struct {
-	Token string `json:"token"`
-	Error string `json:"error,omitempty"`
+	Token     string `json:"token,omitempty"`
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
 // SecretResponse for secret endpoints
 type SecretResponse struct {
 	Secret string `json:"secret"`
-	Error  string `json:"error,omitempty"`
+	// Exposure is set when the policy only allows a masked value or fingerprint
+	Exposure string `json:"exposure,omitempty"`
 }
 
+// contextKey namespaces values stored on the request context
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
 // HealthResponse for health check
 type HealthResponse struct {
 	Status string `json:"status"`
 }
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using system environment variables")
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAuditCommand(os.Args[2:]))
 	}
 
-	config := &Config{
-		JWTSecret:      getEnv("JWT_SECRET", "your-jwt-secret-change-this"),
-		Port:           getEnv("PORT", "8080"),
-		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "https://ethanmerrill.com"),
-		AuthUsername:   getEnv("VITE_SECRETS_SERVICE_USERNAME", "admin"),
-		AuthPassword:   getEnv("VITE_SECRETS_SERVICE_PASSWORD", "changeme"),
-		OpenAIKey:      getEnv("OPENAI_API_KEY", ""),
-		FirebaseKey:    getEnv("FIREBASE_API_KEY", ""),
+	configPath := flag.String("config", "", "path to the YAML config file")
+	flag.Parse()
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Log configuration (without sensitive data)
 	log.Printf("Configuration loaded:")
+	log.Printf("  Environment: %s", config.Environment)
 	log.Printf("  Port: %s", config.Port)
 
 	log.Printf("  Auth Username: %s", config.AuthUsername)
 	log.Printf("  JWT Secret configured: %t", config.JWTSecret != "")
-	log.Printf("  OpenAI Key configured: %t", config.OpenAIKey != "")
-	log.Printf("  Firebase Key configured: %t", config.FirebaseKey != "")
+	log.Printf("  Chat rate limit: %d/min, burst %d, daily quota %d", config.Chat.RateLimitPerMinute, config.Chat.RateLimitBurst, config.Chat.DailyQuota)
+	log.Printf("  TLS enabled: %t (min version %s, client certs for admin: %t)", config.TLS.Enabled, config.TLS.MinVersion, config.TLS.mutualTLS())
+	log.Printf("  Audit log: %s", config.Audit.File)
+	log.Printf("  OIDC login enabled: %t", config.OIDC.Enabled())
+	log.Printf("  Chat cache: %d entries, %ds TTL, similarity %.2f", config.Chat.CacheMaxEntries, config.Chat.CacheTTLSeconds, config.Chat.CacheSimilarity)
+	log.Printf("  Chat budget: $%.2f/day, $%.2f/month (usage file: %s)", config.Chat.DailyBudgetUSD, config.Chat.MonthlyBudgetUSD, config.Chat.UsageFile)
+	log.Printf("  Chat model: %s, max_tokens %d, temperature %.1f, %d routes", config.Chat.Model, config.Chat.MaxTokens, config.Chat.Temperature, len(config.Chat.Routes))
+
+	// Validate configuration; production refuses to start with default secrets
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	for _, warning := range config.Warnings() {
+		log.Printf("WARNING: %s", warning)
+	}
+
+	log.Println("Environment validation complete, starting service...")
 
-	// Validate required environment variables
-	if config.JWTSecret == "your-jwt-secret-change-this" {
-		log.Println("WARNING: Using default JWT secret. This is insecure for production!")
+	// Initialize ChatService
+	chatService := internal.NewChatService(config.OpenAIKey)
+
+	// Track token usage and cap OpenAI spend
+	usageTracker, err := internal.NewUsageTracker(config.Chat.UsageFile, config.Chat.ModelPrices, config.Chat.DailyBudgetUSD, config.Chat.MonthlyBudgetUSD)
+	if err != nil {
+		log.Fatalf("Failed to load usage totals: %v", err)
+	}
+	chatService.Usage = usageTracker
+	chatService.Suggestions = config.Chat.Suggestions
+	chatService.FollowUps = config.Chat.FollowUps
+	chatService.Model = config.Chat.modelParams()
+	chatService.Routes = config.Chat.Routes
+	prompts, err := internal.NewPromptTemplates(config.Chat.PromptTemplates, config.Chat.Prompts)
+	if err != nil {
+		log.Fatalf("Invalid prompt templates: %v", err)
 	}
+	chatService.Prompts = prompts
+	log.Printf("Chat prompt templates: %s", prompts)
+	chatService.ClaimCheck = config.Chat.ClaimCheck
+	chatService.MaxMessageLength = config.Chat.MaxMessageLength
+	chatService.InjectionCheck = config.Chat.InjectionCheck
+	if config.Chat.Moderation {
+		chatService.Moderator = internal.NewOpenAIModerator(chatService.OpenAIKey)
+	}
+
+	metrics := internal.NewMetrics()
+	chatService.Metrics = metrics
 
-	if config.OpenAIKey == "" {
-		log.Println("WARNING: OPENAI_API_KEY environment variable is not set. OpenAI functionality will be disabled.")
+	// Answer repeated questions from memory; the prompt version in the key
+	// drops stale answers when the work history changes
+	if config.Chat.CacheMaxEntries > 0 && config.Chat.CacheTTLSeconds > 0 {
+		chatService.Cache = internal.NewChatCache(config.Chat.CacheMaxEntries, time.Duration(config.Chat.CacheTTLSeconds)*time.Second)
+		chatService.Cache.Similarity = config.Chat.CacheSimilarity
+		chatService.Cache.Metrics = metrics
 	}
 
-	log.Println("Environment validation complete, starting service...")
+	// Record logins, token issuance and secret reads
+	var auditLog *internal.AuditLog
+	if config.Audit.File != "" {
+		auditLog, err = internal.OpenAuditLog(config.Audit.File)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+	}
+
+	secretStores, err := newSecretStores(config, *configPath)
+	if err != nil {
+		log.Fatalf("Failed to load secret store: %v", err)
+	}
+	log.Printf("Secrets configured: %d", len(secretStores.Names()))
+	logSecretInventory(secretStores)
+	// Resolve the OpenAI key per request so rotations apply without a restart
+	chatService.Secrets = secretStores
+
+	// Hashed API keys for scripts and other services
+	apiKeys, err := internal.NewAPIKeyStore(config.APIKeys.File)
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+
+	// Evaluate which visitors may read which secret
+	secretPolicies, err := internal.NewSecretPolicyEngine(config.Secrets.policies())
+	if err != nil {
+		log.Fatalf("Invalid secret policies: %v", err)
+	}
 
 	service := &SecretService{
 		config: config,
+		chat:   chatService,
+		usage:  usageTracker,
+		// Rate limit chat per visitor (token subject + client IP) to protect the OpenAI budget
+		rateLimiter: internal.NewRateLimiter(subjectFromRequest, config.TrustProxyHeaders),
+		metrics:     metrics,
+		revocations: internal.NewTokenRevocations(),
+		auditLog:    auditLog,
+		secrets:     secretStores,
+		policies:    secretPolicies,
+		apiKeys:     apiKeys,
+		oidc:        newOIDCProvider(config.OIDC),
 	}
 
-	// Initialize ChatService
-	chatService := internal.NewChatService(config.OpenAIKey)
+	// Pick up rotated secrets from edited files, or at once on SIGHUP
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go service.watchSecrets(time.Duration(config.Secrets.ReloadIntervalSeconds)*time.Second, hangup)
+
+	log.Fatal(serve(config, service.routes(), service.adminRoutes()))
+}
+
+// routes registers every endpoint with its middleware and returns the
+// complete handler chain served by the listener
+func (s *SecretService) routes() http.Handler {
+	config := s.config
 
 	// Setup routes
 	router := mux.NewRouter()
 
+	router.NotFoundHandler = internal.NotFoundHandler()
+	router.MethodNotAllowedHandler = internal.MethodNotAllowedHandler()
+
 	// Add request logging middleware
-	router.Use(service.loggingMiddleware)
+	router.Use(s.loggingMiddleware)
+
+	// Body size limits and JSON-only writes
+	router.Use(internal.BodyLimit(config.Security.MaxBodyBytes, config.Security.RouteBodyLimits))
+	router.Use(internal.RequireJSON)
 
 	// Health check endpoint
-	router.HandleFunc("/health", service.healthHandler).Methods("GET")
+	router.HandleFunc("/health", s.healthHandler).Methods("GET")
 	log.Println("Registered route: GET /health")
 
+	// API description
+	router.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	log.Println("Registered route: GET /openapi.json")
+
 	// Authentication endpoint
-	router.HandleFunc("/auth", service.authHandler).Methods("POST")
+	router.Handle("/auth", internal.NoStore(http.HandlerFunc(s.authHandler))).Methods("POST")
 	log.Println("Registered route: POST /auth")
+	router.Handle("/auth/logout", internal.NoStore(http.HandlerFunc(s.logoutHandler))).Methods("POST")
+	log.Println("Registered route: POST /auth/logout")
+	if s.oidc != nil {
+		s.registerOIDCRoutes(router)
+	}
+
+	// Versioned API
+	s.registerAPIRoutes(router.PathPrefix("/api/v1").Subrouter())
+	log.Println("Registered protected routes: GET /api/v1/secrets/openai, GET /api/v1/secrets/{secretName}, POST /api/v1/chat, GET /api/v1/chat/suggestions")
 
-	// Protected secret endpoints
-	apiRouter := router.PathPrefix("/api").Subrouter()
-	apiRouter.Use(service.jwtMiddleware)
-	apiRouter.HandleFunc("/secrets/openai", service.getOpenAIKeyHandler).Methods("GET")
-	apiRouter.HandleFunc("/secrets/{secretName}", service.getSecretHandler).Methods("GET")
-	apiRouter.HandleFunc("/chat", chatService.ChatHandler).Methods("POST")
-	log.Println("Registered protected routes: GET /api/secrets/openai, GET /api/secrets/{secretName}, POST /api/chat")
+	// Unversioned aliases kept for deployed frontends, marked deprecated
+	if config.API.LegacyRoutes {
+		deprecation, _ := config.API.deprecation()
+		deprecation.Successor = func(path string) string {
+			return "/api/v1" + strings.TrimPrefix(path, "/api")
+		}
+		legacyRouter := router.PathPrefix("/api").Subrouter()
+		legacyRouter.Use(internal.Deprecated(deprecation, s.metrics))
+		s.registerAPIRoutes(legacyRouter)
+		log.Printf("Registered deprecated /api aliases (sunset %s)", config.API.LegacySunset)
+	}
 
 	// Setup CORS
-	// Parse comma-separated allowed origins
-	originsSlice := strings.Split(config.AllowedOrigins, ",")
-
-	// Add localhost origins for development
-	originsSlice = append(originsSlice, "http://localhost:3000", "http://localhost:5173")
-	log.Printf("CORS configured with origins: %v", originsSlice)
-
-	c := cors.New(cors.Options{
-		AllowedOrigins:   originsSlice,
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	})
+	handler := newCORSHandler(config.CORS, config.Environment, router)
+
+	// Security headers and request IDs apply to every response, including 404s and preflights
+	handler = internal.SecurityHeaders(internal.SecurityHeaderOptions{
+		HSTSMaxAgeSeconds:     config.Security.HSTSMaxAgeSeconds,
+		HSTSIncludeSubdomains: config.Security.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: config.Security.ContentSecurityPolicy,
+	})(handler)
+	return internal.RequestID(handler)
+}
 
-	handler := c.Handler(router)
+// registerAPIRoutes adds the JWT-protected API to a versioned (or legacy) subrouter
+func (s *SecretService) registerAPIRoutes(apiRouter *mux.Router) {
+	chatPolicy := internal.RateLimitPolicy{
+		Name:       "chat",
+		PerMinute:  s.config.Chat.RateLimitPerMinute,
+		Burst:      s.config.Chat.RateLimitBurst,
+		DailyQuota: s.config.Chat.DailyQuota,
+	}
 
-	log.Printf("Server starting on port %s, listening at http://localhost:%s", config.Port, config.Port)
-	log.Printf("Allowed origins: %s", originsSlice)
-	log.Fatal(http.ListenAndServe(":"+config.Port, handler))
+	apiRouter.Use(s.jwtMiddleware)
+	apiRouter.Handle("/secrets", internal.NoStore(http.HandlerFunc(s.listSecretsHandler))).Methods("GET")
+	apiRouter.Handle("/secrets/openai", internal.NoStore(http.HandlerFunc(s.getOpenAIKeyHandler))).Methods("GET")
+	apiRouter.Handle("/secrets/{secretName}", internal.NoStore(http.HandlerFunc(s.getSecretHandler))).Methods("GET")
+	apiRouter.HandleFunc("/chat/suggestions", s.chat.SuggestionsHandler).Methods("GET")
+	apiRouter.Handle("/chat", s.rateLimiter.Limit(chatPolicy, http.HandlerFunc(s.chat.ChatHandler))).Methods("POST")
 }
 
 // loggingMiddleware logs all incoming requests
@@ -155,7 +295,7 @@ func (s *SecretService) loggingMiddleware(next http.Handler) http.Handler {
 		start := time.Now()
 
 		// Log the incoming request
-		log.Printf("Request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		log.Printf("Request: %s %s from %s (request_id=%s)", r.Method, r.URL.Path, r.RemoteAddr, internal.RequestIDFromContext(r.Context()))
 
 		// Create a response writer wrapper to capture status code
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
@@ -164,7 +304,9 @@ func (s *SecretService) loggingMiddleware(next http.Handler) http.Handler {
 
 		// Log the response
 		duration := time.Since(start)
-		log.Printf("Response: %s %s - Status: %d - Duration: %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+		log.Printf("Response: %s %s - Status: %d - Duration: %v (request_id=%s)", r.Method, r.URL.Path, wrapped.statusCode, duration, internal.RequestIDFromContext(r.Context()))
+		s.metrics.Inc("http_requests_total", "HTTP requests by route and status.",
+			"method", r.Method, "route", internal.RouteLabel(r), "status", strconv.Itoa(wrapped.statusCode))
 	})
 }
 
@@ -190,9 +332,10 @@ func (s *SecretService) authHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Authentication attempt from %s", r.RemoteAddr)
 
 	var req AuthRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
 		log.Printf("Authentication failed: invalid request body - %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Reason: "invalid request body"})
+		internal.WriteDecodeError(w, r, err)
 		return
 	}
 
@@ -200,85 +343,165 @@ func (s *SecretService) authHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Use config values for authentication
 	if req.Username != s.config.AuthUsername || req.Password != s.config.AuthPassword {
-		log.Printf("Authentication failed: invalid credentials for username: %s, password: %s", req.Username, req.Password)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(AuthResponse{Error: "Invalid credentials"})
+		log.Printf("Authentication failed: invalid credentials for username: %s", req.Username)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Subject: req.Username, Reason: "invalid credentials"})
+		internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 
-	// Create JWT token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: req.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+	claims, tokenString, err := s.issueToken(req.Username, s.config.AuthRoles)
 	if err != nil {
 		log.Printf("Authentication failed: token generation error - %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(AuthResponse{Error: "Failed to generate token"})
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditError, Subject: req.Username, Reason: "token generation failed"})
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to generate token")
 		return
 	}
 
 	log.Printf("Authentication successful for username: %s", req.Username)
+	s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditSuccess, Subject: req.Username})
+	s.audit(r, internal.AuditEvent{Action: internal.AuditTokenIssue, Outcome: internal.AuditSuccess, Subject: req.Username, TokenID: claims.ID})
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AuthResponse{Token: tokenString})
+	json.NewEncoder(w).Encode(s.startSession(w, claims, tokenString))
+}
+
+// issueToken signs a session JWT; the ID lets the admin API revoke it
+func (s *SecretService) issueToken(username string, roles []string) (*Claims, string, error) {
+	now := time.Now()
+	claims := &Claims{
+		Username: username,
+		Roles:    roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newTokenID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenLifetime)),
+		},
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.config.JWTSecret))
+	return claims, tokenString, err
+}
+
+// errTokenRevoked is returned by sessionClaims for a revoked token
+var errTokenRevoked = errors.New("token revoked")
+
+// sessionClaims validates a session JWT and checks it has not been revoked
+func (s *SecretService) sessionClaims(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.jwtKey)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token is not valid")
+	}
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	if s.revocations.IsRevoked(claims.ID, issuedAt) {
+		return claims, errTokenRevoked
+	}
+	return claims, nil
 }
 
 func (s *SecretService) jwtMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("JWT validation for request: %s %s", r.Method, r.URL.Path)
 
+		// Machine clients authenticate with an API key instead of a JWT
+		if key := apiKeyFromRequest(r); key != "" {
+			claims, err := s.apiKeyClaims(r, key)
+			if err != nil {
+				log.Printf("API key validation failed: %v", err)
+				message := "Invalid API key"
+				if errors.Is(err, internal.ErrAPIKeyExpired) || errors.Is(err, internal.ErrAPIKeyRevoked) {
+					message = "API key has expired or been revoked"
+				}
+				internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidToken, message)
+				return
+			}
+			log.Printf("API key validation successful for %s", claims.Username)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
+			return
+		}
+
+		// Browsers on cookie sessions send the token as a cookie instead
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		tokenString, fromCookie := s.sessionTokenFromRequest(r)
+		if authHeader == "" && !fromCookie {
 			log.Printf("JWT validation failed: missing authorization header")
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeAuthRequired, "Authorization header required")
 			return
 		}
-
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
+		if !fromCookie && tokenString == authHeader {
 			log.Printf("JWT validation failed: invalid bearer token format")
-			http.Error(w, "Bearer token required", http.StatusUnauthorized)
+			internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeAuthRequired, "Bearer token required")
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.config.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := s.sessionClaims(tokenString)
+		if errors.Is(err, errTokenRevoked) {
+			log.Printf("JWT validation failed: token %s for %s was revoked", claims.ID, claims.Username)
+			internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidToken, "Token has been revoked")
+			return
+		}
+		if err != nil {
 			log.Printf("JWT validation failed: invalid token - %v", err)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidToken, "Invalid token")
 			return
 		}
+		if fromCookie {
+			if err := s.checkCSRF(r, claims); err != nil {
+				log.Printf("JWT validation failed: %v for %s %s", err, r.Method, r.URL.Path)
+				internal.WriteError(w, r, http.StatusForbidden, internal.CodeCSRFFailed, "CSRF token missing or invalid")
+				return
+			}
+		}
 
 		log.Printf("JWT validation successful for user: %s", claims.Username)
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims)))
 	})
 }
 
-func (s *SecretService) getOpenAIKeyHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("OpenAI key requested from %s", r.RemoteAddr)
+// audit records an event with the caller's IP, user agent, request ID and,
+// when not set, the token subject. Failures are logged but do not fail the request.
+func (s *SecretService) audit(r *http.Request, event internal.AuditEvent) {
+	event.IP = internal.ClientIP(r, s.config.TrustProxyHeaders)
+	event.UserAgent = r.UserAgent()
+	if len(event.UserAgent) > 256 {
+		event.UserAgent = event.UserAgent[:256]
+	}
+	event.RequestID = internal.RequestIDFromContext(r.Context())
+	if event.Subject == "" {
+		event.Subject = subjectFromRequest(r)
+	}
+	if err := s.auditLog.Record(event); err != nil {
+		log.Printf("Failed to write audit event %s (request_id=%s): %v", event.Action, event.RequestID, err)
+	}
+}
 
-	if s.config.OpenAIKey == "" {
-		log.Printf("OpenAI API key not configured")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(SecretResponse{Error: "Secret not configured"})
-		return
+// jwtKey returns the HMAC key used to sign and verify visitor tokens
+func (s *SecretService) jwtKey(*jwt.Token) (interface{}, error) {
+	return []byte(s.config.JWTSecret), nil
+}
+
+// newTokenID returns a random JWT ID (jti)
+func newTokenID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// subjectFromRequest returns the username of the validated token, if any
+func subjectFromRequest(r *http.Request) string {
+	if claims, ok := r.Context().Value(claimsContextKey).(*Claims); ok {
+		return claims.Username
 	}
+	return ""
+}
 
-	log.Printf("OpenAI key successfully provided")
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(SecretResponse{Secret: s.config.OpenAIKey})
+func (s *SecretService) getOpenAIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("OpenAI key requested from %s", r.RemoteAddr)
+	s.serveSecret(w, r, "openai")
 }
 
 func (s *SecretService) getSecretHandler(w http.ResponseWriter, r *http.Request) {
@@ -286,44 +509,42 @@ func (s *SecretService) getSecretHandler(w http.ResponseWriter, r *http.Request)
 	secretName := vars["secretName"]
 
 	log.Printf("Secret '%s' requested from %s", secretName, r.RemoteAddr)
+	s.serveSecret(w, r, secretName)
+}
 
-	var secret string
-	var ok bool
-
-	// Security: Only allow specific secret names and map to config fields
-	switch secretName {
-	case "openai":
-		secret = s.config.OpenAIKey
-		ok = secret != ""
-		log.Printf("OpenAI secret requested, configured: %t", ok)
-	case "firebase":
-		secret = s.config.FirebaseKey
-		ok = secret != ""
-		log.Printf("Firebase secret requested, configured: %t", ok)
-	default:
-		log.Printf("Forbidden secret requested: %s", secretName)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(SecretResponse{Error: "Secret not allowed"})
+// serveSecret checks the secret's policy and writes as much of its current
+// value as the policy exposes
+func (s *SecretService) serveSecret(w http.ResponseWriter, r *http.Request, secretName string) {
+	access := internal.SecretAccess{Secret: secretName, Origin: r.Header.Get("Origin"), Time: time.Now()}
+	if claims, ok := r.Context().Value(claimsContextKey).(*Claims); ok {
+		access.Subject, access.Roles = claims.Username, claims.Roles
+	}
+	decision := s.policies.Evaluate(access)
+	if !decision.Allowed {
+		log.Printf("Secret '%s' denied to %s: %s", secretName, access.Subject, decision.Reason)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditSecretRead, Outcome: internal.AuditDenied, Secret: secretName, Reason: decision.Reason})
+		if decision.RetryAfter > 0 {
+			internal.WriteErrorRetryAfter(w, r, http.StatusTooManyRequests, internal.CodeRateLimited, "Secret read limit reached", decision.RetryAfter)
+			return
+		}
+		internal.WriteError(w, r, http.StatusForbidden, internal.CodeSecretNotAllowed, "Secret not allowed")
 		return
 	}
 
-	if !ok {
+	secret, err := s.secrets.Get(secretName)
+	if err != nil {
 		log.Printf("Secret %s not configured", secretName)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(SecretResponse{Error: "Secret not configured"})
+		s.audit(r, internal.AuditEvent{Action: internal.AuditSecretRead, Outcome: internal.AuditError, Secret: secretName, Reason: "not configured"})
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeSecretNotConfigured, "Secret not configured")
 		return
 	}
 
-	log.Printf("Secret '%s' successfully provided", secretName)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(SecretResponse{Secret: secret})
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	response := SecretResponse{Secret: internal.ExposeSecret(secret.Value, decision.Exposure)}
+	if decision.Exposure != internal.ExposureRaw {
+		response.Exposure = decision.Exposure
 	}
-	return defaultValue
+	log.Printf("Secret '%s' successfully provided (%s backend, version %d, %s)", secretName, secret.Backend, secret.Version, decision.Exposure)
+	s.audit(r, internal.AuditEvent{Action: internal.AuditSecretRead, Outcome: internal.AuditSuccess, Secret: secretName, Version: secret.Version})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"portfolio-secrets-service/internal"
 )
 
 func TestHealthHandler(t *testing.T) {
@@ -81,10 +85,6 @@ func TestAuthHandler(t *testing.T) {
 	if response.Token == "" {
 		t.Error("Expected token in response")
 	}
-
-	if response.Error != "" {
-		t.Errorf("Unexpected error: %v", response.Error)
-	}
 }
 
 func TestAuthHandlerInvalidCredentials(t *testing.T) {
@@ -121,4 +121,204 @@ func TestAuthHandlerInvalidCredentials(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusUnauthorized)
 	}
+
+	var response internal.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal("Could not parse error response")
+	}
+	if response.Code != internal.CodeInvalidCredentials || response.Message == "" {
+		t.Errorf("Unexpected error response: %+v", response)
+	}
+}
+
+func TestJWTMiddlewareErrorEnvelope(t *testing.T) {
+	service := &SecretService{
+		config: &Config{JWTSecret: "test-secret"},
+	}
+	handler := internal.RequestID(service.jwtMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler should not be called")
+	})))
+
+	tests := []struct {
+		name   string
+		header string
+		code   internal.ErrorCode
+	}{
+		{"missing header", "", internal.CodeAuthRequired},
+		{"not bearer", "Basic abc", internal.CodeAuthRequired},
+		{"bad token", "Bearer not-a-jwt", internal.CodeInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/secrets/openai", nil)
+			req.Header.Set("X-Request-ID", "req-123")
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", rr.Code)
+			}
+			var response internal.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("expected JSON error body, got %q", rr.Body.String())
+			}
+			if response.Code != tt.code || response.RequestID != "req-123" || response.Retryable {
+				t.Errorf("unexpected error response: %+v", response)
+			}
+		})
+	}
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	service := newContractTestService(t, "sk-test")
+	handler := service.routes()
+
+	send := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	legacy := send("/api/secrets/openai")
+	if legacy.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", legacy.Code)
+	}
+	if got := legacy.Header().Get("Deprecation"); got != "@1790812800" {
+		t.Errorf("Deprecation = %q, want @1790812800", got)
+	}
+	if got := legacy.Header().Get("Sunset"); got != "Thu, 01 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Sunset = %q", got)
+	}
+	if got := legacy.Header().Get("Link"); got != `</api/v1/secrets/openai>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+	if got := service.metrics.Value("deprecated_route_requests_total", "method", "GET", "route", "/api/secrets/openai"); got != 1 {
+		t.Errorf("deprecated route counter = %v, want 1", got)
+	}
+
+	current := send("/api/v1/secrets/openai")
+	if current.Header().Get("Deprecation") != "" || current.Header().Get("Sunset") != "" {
+		t.Errorf("versioned route should not be marked deprecated: %v", current.Header())
+	}
+
+	service.config.API.LegacyRoutes = false
+	handler = service.routes()
+	if rr := send("/api/secrets/openai"); rr.Code != http.StatusNotFound {
+		t.Errorf("legacy routes disabled: status = %d, want 404", rr.Code)
+	}
+}
+
+func TestSecretPolicies(t *testing.T) {
+	service := newContractTestService(t, "sk-proj-abcdefghijklmnop1234")
+	policies, err := internal.NewSecretPolicyEngine(map[string]internal.SecretPolicy{
+		"openai":   {Exposure: internal.ExposureMasked, Origins: []string{"https://ethanmerrill.com"}, MaxReadsPerHour: 1},
+		"firebase": {Roles: []string{"admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.policies = policies
+	handler := service.routes()
+
+	login := httptest.NewRecorder()
+	loginReq := httptest.NewRequest("POST", "/auth", strings.NewReader(`{"username":"testuser","password":"testpass"}`))
+	loginReq.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(login, loginReq)
+	var auth AuthResponse
+	json.Unmarshal(login.Body.Bytes(), &auth)
+
+	read := func(path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := read("/api/v1/secrets/openai", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("without origin: status = %d, want 403", rr.Code)
+	}
+	rr := read("/api/v1/secrets/openai", "https://ethanmerrill.com")
+	var secret SecretResponse
+	json.Unmarshal(rr.Body.Bytes(), &secret)
+	if rr.Code != http.StatusOK || secret.Secret != "sk-*********************1234" || secret.Exposure != "masked" {
+		t.Errorf("masked read: status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if rr := read("/api/v1/secrets/openai", "https://ethanmerrill.com"); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("second read in the hour: status = %d, headers %v", rr.Code, rr.Header())
+	}
+	// The visitor role is not allowed to read firebase
+	if rr := read("/api/v1/secrets/firebase", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("firebase as visitor: status = %d, want 403", rr.Code)
+	}
+
+	events, err := service.auditLog.Query(internal.AuditFilter{Action: internal.AuditSecretRead, Outcome: internal.AuditDenied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, event := range events {
+		reasons = append(reasons, event.Reason)
+	}
+	want := []string{"origin required", "more than 1 reads in the last hour", `subject "testuser" with roles [visitor] not allowed`}
+	if strings.Join(reasons, "|") != strings.Join(want, "|") {
+		t.Errorf("denial reasons = %q, want %q", reasons, want)
+	}
+}
+
+func TestListSecretMetadata(t *testing.T) {
+	service := newContractTestService(t, "sk-test")
+	service.config.AuthRoles = []string{"operator"}
+	handler := service.routes()
+
+	expiresAt := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := service.secrets.Writable().PutExpiring("deploy-key", "dk-value", expiresAt, 0); err != nil {
+		t.Fatal(err)
+	}
+	service.secrets.Writable().Put("openai", "sk-rotated", 0)
+
+	login := httptest.NewRecorder()
+	loginReq := httptest.NewRequest("POST", "/auth", strings.NewReader(`{"username":"testuser","password":"testpass"}`))
+	loginReq.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(login, loginReq)
+	var auth AuthResponse
+	json.Unmarshal(login.Body.Bytes(), &auth)
+
+	req := httptest.NewRequest("GET", "/api/v1/secrets", nil)
+	req.Header.Set("Authorization", "Bearer "+auth.Token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var list SecretListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	for _, value := range []string{"sk-test", "sk-rotated", "dk-value"} {
+		if strings.Contains(rr.Body.String(), value) {
+			t.Errorf("listing leaks %q", value)
+		}
+	}
+	byName := map[string]SecretInfo{}
+	for _, info := range list.Secrets {
+		byName[info.Name] = info
+	}
+	if len(list.Secrets) != 3 || list.Secrets[0].Name != "deploy-key" {
+		t.Fatalf("secrets = %+v, want deploy-key, firebase and openai", list.Secrets)
+	}
+	if info := byName["deploy-key"]; info.ExpiresAt == nil || !info.ExpiresAt.Equal(expiresAt) || info.Backend != "file" {
+		t.Errorf("deploy-key = %+v", info)
+	}
+	if info := byName["openai"]; info.Backend != "file" || info.Fingerprint != internal.SecretFingerprint("sk-rotated") {
+		t.Errorf("openai should show the file version shadowing env: %+v", info)
+	}
+	if info := byName["firebase"]; info.Backend != "env" || info.Version != 1 || info.ExpiresAt != nil {
+		t.Errorf("firebase = %+v", info)
+	}
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"portfolio-secrets-service/internal"
+)
+
+// oidcLoginCookie carries the state, nonce and PKCE verifier from the login
+// redirect to the callback, so any replica can finish the sign-in
+const oidcLoginCookie = "oidc_login"
+
+// oidcLoginMaxAge is how long a user has to sign in at the issuer
+const oidcLoginMaxAge = 600
+
+// newOIDCProvider returns nil when OIDC login is not configured
+func newOIDCProvider(config OIDCConfig) *internal.OIDCProvider {
+	if !config.Enabled() {
+		return nil
+	}
+	return &internal.OIDCProvider{
+		Issuer:       config.Issuer,
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
+		Scopes:       config.Scopes,
+	}
+}
+
+// registerOIDCRoutes adds the sign-in redirect and callback to the public router
+func (s *SecretService) registerOIDCRoutes(router *mux.Router) {
+	router.Handle("/auth/oidc/login", internal.NoStore(http.HandlerFunc(s.oidcLoginHandler))).Methods("GET")
+	router.Handle("/auth/oidc/callback", internal.NoStore(http.HandlerFunc(s.oidcCallbackHandler))).Methods("GET")
+	log.Printf("Registered routes: GET /auth/oidc/login, GET /auth/oidc/callback (issuer %s)", s.config.OIDC.Issuer)
+}
+
+// oidcLoginHandler starts a sign-in by redirecting to the issuer
+func (s *SecretService) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	login := internal.NewOIDCLogin()
+	target, err := s.oidc.AuthCodeURL(r.Context(), login)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		internal.WriteError(w, r, http.StatusBadGateway, internal.CodeUpstreamDown, "Identity provider unavailable")
+		return
+	}
+	value, _ := json.Marshal(login)
+	http.SetCookie(w, s.oidcCookie(base64.RawURLEncoding.EncodeToString(value), oidcLoginMaxAge))
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// oidcCallbackHandler redeems the authorization code, checks the account is
+// allowed and issues our own session token with the mapped roles
+func (s *SecretService) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	// The pending login is single use whatever the outcome
+	http.SetCookie(w, s.oidcCookie("", -1))
+
+	query := r.URL.Query()
+	login, ok := oidcLoginFromRequest(r)
+	if !ok || subtle.ConstantTimeCompare([]byte(login.State), []byte(query.Get("state"))) != 1 {
+		log.Printf("OIDC callback failed: missing or mismatched state from %s", r.RemoteAddr)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Reason: "oidc: state mismatch"})
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "Sign-in expired or was started elsewhere, try again")
+		return
+	}
+	if issuerError := query.Get("error"); issuerError != "" {
+		log.Printf("OIDC callback failed: issuer returned %s", issuerError)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Reason: "oidc: " + issuerError})
+		internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidCredentials, "Sign-in was refused by the identity provider")
+		return
+	}
+
+	identity, err := s.oidc.Exchange(r.Context(), query.Get("code"), login)
+	if err != nil {
+		log.Printf("OIDC callback failed: %v", err)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Reason: "oidc: code exchange failed"})
+		internal.WriteError(w, r, http.StatusUnauthorized, internal.CodeInvalidCredentials, "Sign-in could not be verified")
+		return
+	}
+	if !s.config.OIDC.allows(identity) {
+		log.Printf("OIDC callback failed: account %q (sub %s) is not allowed", identity.Email, identity.Subject)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditFailure, Subject: identity.Email, Reason: "oidc: account not allowed"})
+		internal.WriteError(w, r, http.StatusForbidden, internal.CodeAccountNotAllowed, "This account is not allowed to sign in")
+		return
+	}
+
+	claims, tokenString, err := s.issueToken(identity.Email, s.config.OIDC.roles(identity))
+	if err != nil {
+		log.Printf("OIDC callback failed: token generation error - %v", err)
+		s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditError, Subject: identity.Email, Reason: "token generation failed"})
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to generate token")
+		return
+	}
+
+	log.Printf("OIDC sign-in successful for %s with roles %v", identity.Email, claims.Roles)
+	s.audit(r, internal.AuditEvent{Action: internal.AuditAuthAttempt, Outcome: internal.AuditSuccess, Subject: identity.Email, Reason: "oidc"})
+	s.audit(r, internal.AuditEvent{Action: internal.AuditTokenIssue, Outcome: internal.AuditSuccess, Subject: identity.Email, TokenID: claims.ID, Reason: "oidc"})
+
+	session := s.startSession(w, claims, tokenString)
+	if redirect := s.config.OIDC.PostLoginRedirect; redirect != "" {
+		// The fragment keeps the token out of server logs and Referer headers;
+		// cookie sessions need nothing in the URL
+		if session.Token != "" {
+			redirect += "#token=" + url.QueryEscape(session.Token)
+		}
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// oidcCookie is scoped to the OIDC routes. SameSite=Lax lets it return on
+// the issuer's top-level redirect back to the callback.
+func (s *SecretService) oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.config.OIDC.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func oidcLoginFromRequest(r *http.Request) (internal.OIDCLogin, bool) {
+	var login internal.OIDCLogin
+	cookie, err := r.Cookie(oidcLoginCookie)
+	if err != nil {
+		return login, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || json.Unmarshal(value, &login) != nil {
+		return login, false
+	}
+	return login, login.State != "" && login.Verifier != ""
+}
+
+// allows checks the email against the allowed emails and domains. Emails the
+// issuer does not report as verified, with a boolean true, are refused.
+func (o OIDCConfig) allows(identity internal.OIDCIdentity) bool {
+	if identity.Email == "" || !identity.EmailVerified {
+		return false
+	}
+	for _, email := range o.AllowedEmails {
+		if strings.EqualFold(email, identity.Email) {
+			return true
+		}
+	}
+	_, domain, _ := strings.Cut(identity.Email, "@")
+	for _, allowed := range o.AllowedDomains {
+		if strings.EqualFold(strings.TrimPrefix(allowed, "@"), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// roles returns Roles plus the mapped roles for each value of RoleClaim
+func (o OIDCConfig) roles(identity internal.OIDCIdentity) []string {
+	roles := append([]string{}, o.Roles...)
+	if o.RoleClaim == "" {
+		return roles
+	}
+	for _, value := range identity.ClaimValues(o.RoleClaim) {
+		for _, role := range o.RoleMapping[value] {
+			if !hasAnyRole(roles, []string{role}) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIssuer is a minimal OpenID Connect issuer: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier before returning a signed ID token
+type stubIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	email  string
+	groups []string
+	// verified is the email_verified claim; nil leaves it out
+	verified  interface{}
+	challenge string // from the authorization request
+	nonce     string
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &stubIssuer{key: key, verified: true}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "test-key", "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != issuer.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":    issuer.URL,
+			"aud":    "portfolio",
+			"sub":    "user-123",
+			"email":  issuer.email,
+			"groups": issuer.groups,
+			"nonce":  issuer.nonce,
+			"iat":    time.Now().Unix(),
+			"exp":    time.Now().Add(5 * time.Minute).Unix(),
+		}
+		if issuer.verified != nil {
+			claims["email_verified"] = issuer.verified
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "unused", "id_token": signed})
+	})
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func TestOIDCLogin(t *testing.T) {
+	issuer := newStubIssuer(t)
+	service := newContractTestService(t, "sk-test")
+	service.config.OIDC.Issuer = issuer.URL
+	service.config.OIDC.ClientID = "portfolio"
+	service.config.OIDC.RedirectURL = "https://secrets.example.com/auth/oidc/callback"
+	service.config.OIDC.AllowedDomains = []string{"example.com"}
+	service.config.OIDC.Roles = []string{"operator"}
+	service.config.OIDC.RoleMapping = map[string][]string{"portfolio-admins": {"admin"}}
+	service.oidc = newOIDCProvider(service.config.OIDC)
+	public := service.routes()
+
+	// begin follows the login redirect and records what the issuer would see
+	begin := func(t *testing.T) (*http.Cookie, string) {
+		rr := httptest.NewRecorder()
+		public.ServeHTTP(rr, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+		if rr.Code != http.StatusFound {
+			t.Fatalf("login: status = %d, body %s", rr.Code, rr.Body.String())
+		}
+		location, _ := url.Parse(rr.Header().Get("Location"))
+		query := location.Query()
+		if !strings.HasPrefix(location.String(), issuer.URL+"/authorize?") || query.Get("code_challenge_method") != "S256" {
+			t.Fatalf("login redirect = %s", location)
+		}
+		issuer.challenge, issuer.nonce = query.Get("code_challenge"), query.Get("nonce")
+		cookie := rr.Result().Cookies()[0]
+		if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("login cookie = %+v", cookie)
+		}
+		return cookie, query.Get("state")
+	}
+	callback := func(cookie *http.Cookie, state, code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/auth/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		rr := httptest.NewRecorder()
+		public.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("allowed account gets an admin session", func(t *testing.T) {
+		issuer.email, issuer.groups = "ops@example.com", []string{"portfolio-admins"}
+		cookie, state := begin(t)
+		rr := callback(cookie, state, "good-code")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("callback: status = %d, body %s", rr.Code, rr.Body.String())
+		}
+		var auth AuthResponse
+		json.Unmarshal(rr.Body.Bytes(), &auth)
+		claims, err := service.sessionClaims(auth.Token)
+		if err != nil || claims.Username != "ops@example.com" || strings.Join(claims.Roles, ",") != "operator,admin" {
+			t.Fatalf("claims = %+v, err %v", claims, err)
+		}
+
+		req := httptest.NewRequest("GET", "/admin/config", nil)
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+		admin := httptest.NewRecorder()
+		service.adminRoutes().ServeHTTP(admin, req)
+		if admin.Code != http.StatusOK {
+			t.Errorf("admin listener with OIDC session: status = %d", admin.Code)
+		}
+	})
+
+	t.Run("session without admin role is refused by the admin listener", func(t *testing.T) {
+		issuer.email, issuer.groups = "dev@example.com", nil
+		cookie, state := begin(t)
+		var auth AuthResponse
+		json.Unmarshal(callback(cookie, state, "good-code").Body.Bytes(), &auth)
+		req := httptest.NewRequest("GET", "/admin/config", nil)
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+		rr := httptest.NewRecorder()
+		service.adminRoutes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rr.Code)
+		}
+	})
+
+	t.Run("account outside the allowed domains", func(t *testing.T) {
+		issuer.email = "someone@elsewhere.org"
+		cookie, state := begin(t)
+		rr := callback(cookie, state, "good-code")
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"account_not_allowed"`) {
+			t.Errorf("status = %d, body %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("email not verified", func(t *testing.T) {
+		issuer.email, issuer.groups = "ops@example.com", []string{"portfolio-admins"}
+		defer func() { issuer.verified = true }()
+		for _, verified := range []interface{}{nil, "false", "true", false} {
+			issuer.verified = verified
+			cookie, state := begin(t)
+			if rr := callback(cookie, state, "good-code"); rr.Code != http.StatusForbidden {
+				t.Errorf("email_verified %#v: status = %d, want 403", verified, rr.Code)
+			}
+		}
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		issuer.email = "ops@example.com"
+		cookie, _ := begin(t)
+		if rr := callback(cookie, "forged", "good-code"); rr.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rr.Code)
+		}
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		cookie, state := begin(t)
+		issuer.challenge = "not-the-challenge"
+		if rr := callback(cookie, state, "good-code"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec documents every public route and its error shapes. Keep it in
+// sync with the handlers; openapi_test.go fails when responses drift.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
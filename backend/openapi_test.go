@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"portfolio-secrets-service/internal"
+)
+
+// specValidator checks JSON bodies against the subset of OpenAPI schema
+// keywords used in openapi.json.
+type specValidator struct {
+	doc map[string]interface{}
+}
+
+func loadSpec(t *testing.T) *specValidator {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return &specValidator{doc: doc}
+}
+
+// resolve follows $ref pointers such as #/components/schemas/ErrorResponse
+func (v *specValidator) resolve(node map[string]interface{}) map[string]interface{} {
+	for {
+		ref, ok := node["$ref"].(string)
+		if !ok {
+			return node
+		}
+		var current interface{} = v.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			current = current.(map[string]interface{})[part]
+		}
+		node = current.(map[string]interface{})
+	}
+}
+
+// responseSchema finds the schema documented for method, path and status
+func (v *specValidator) responseSchema(method, path string, status int) (map[string]interface{}, error) {
+	paths := v.doc["paths"].(map[string]interface{})
+	for template, item := range paths {
+		if !pathMatches(template, path) {
+			continue
+		}
+		operation, ok := item.(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s %s is not documented", method, template)
+		}
+		response, ok := operation["responses"].(map[string]interface{})[strconv.Itoa(status)].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("status %d is not documented for %s %s", status, method, template)
+		}
+		response = v.resolve(response)
+		content := response["content"].(map[string]interface{})["application/json"].(map[string]interface{})
+		return v.resolve(content["schema"].(map[string]interface{})), nil
+	}
+	return nil, fmt.Errorf("path %s is not documented", path)
+}
+
+// pathMatches compares a path against a template like /api/secrets/{secretName}
+func pathMatches(template, path string) bool {
+	templateParts := strings.Split(template, "/")
+	pathParts := strings.Split(path, "/")
+	if len(templateParts) != len(pathParts) {
+		return false
+	}
+	for i, part := range templateParts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// documentedPath maps a deprecated /api alias onto the /api/v1 route it
+// mirrors and drops the query string
+func documentedPath(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	if strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/api/v1/") {
+		return "/api/v1" + strings.TrimPrefix(path, "/api")
+	}
+	return path
+}
+
+func (v *specValidator) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	schema = v.resolve(schema)
+	var problems []string
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if allowed == value {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: expected object, got %T", at, value))
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := object[name.(string)]; !present {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %q", at, name))
+				}
+			}
+		}
+		for name, fieldValue := range object {
+			if propertySchema, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, v.validate(propertySchema, fieldValue, at+"."+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%s: undocumented property %q", at, name))
+				}
+			case map[string]interface{}:
+				problems = append(problems, v.validate(additional, fieldValue, at+"."+name)...)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: expected array, got %T", at, value))
+		}
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range items {
+				problems = append(problems, v.validate(itemSchema, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected string, got %T", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected boolean, got %T", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: expected number, got %T", at, value))
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			problems = append(problems, fmt.Sprintf("%s: expected integer, got %v", at, value))
+		}
+	}
+	return problems
+}
+
+// checkResponse fails the test when rr does not match the documented response
+func (v *specValidator) checkResponse(t *testing.T, method, path string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	schema, err := v.responseSchema(method, path, rr.Code)
+	if err != nil {
+		t.Errorf("%s %s -> %d: %v (body %s)", method, path, rr.Code, err, rr.Body.String())
+		return
+	}
+	var body interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Errorf("%s %s -> %d: body is not JSON: %q", method, path, rr.Code, rr.Body.String())
+		return
+	}
+	for _, problem := range v.validate(schema, body, "body") {
+		t.Errorf("%s %s -> %d: %s", method, path, rr.Code, problem)
+	}
+}
+
+func newContractTestService(t *testing.T, openAIKey string) *SecretService {
+	t.Helper()
+
+	openAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"gpt-3.5-turbo","choices":[{"message":{"content":"Hi!\nSources: senior-consultant-at-captech"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":2}}`))
+	}))
+	t.Cleanup(openAI.Close)
+
+	config := defaultConfig()
+	config.JWTSecret = "contract-test-secret"
+	config.AuthUsername = "testuser"
+	config.AuthPassword = "testpass"
+	config.OpenAIKey = openAIKey
+	config.FirebaseKey = openAIKey
+	config.Chat.RateLimitBurst = 1
+
+	usage, err := internal.NewUsageTracker(filepath.Join(t.TempDir(), "usage.json"), nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, err := internal.OpenAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	config.Secrets.File = filepath.Join(t.TempDir(), "secrets.json")
+	secrets, err := newSecretStores(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policies, err := internal.NewSecretPolicyEngine(config.Secrets.policies())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKeys, err := internal.NewAPIKeyStore(filepath.Join(t.TempDir(), "api_keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chat := internal.NewChatService(openAIKey)
+	chat.Config.CompletionsURL = openAI.URL
+	chat.Usage = usage
+	chat.Secrets = secrets
+	chat.FollowUps = config.Chat.FollowUps
+
+	return &SecretService{
+		config:      config,
+		chat:        chat,
+		usage:       usage,
+		rateLimiter: internal.NewRateLimiter(subjectFromRequest, false),
+		metrics:     internal.NewMetrics(),
+		revocations: internal.NewTokenRevocations(),
+		auditLog:    auditLog,
+		secrets:     secrets,
+		policies:    policies,
+		apiKeys:     apiKeys,
+	}
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	spec := loadSpec(t)
+
+	type contractCase struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  bool
+		header map[string]string
+		status int
+	}
+
+	run := func(t *testing.T, handler http.Handler, token string, tc contractCase) {
+		var req *http.Request
+		if tc.body != "" {
+			req = httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req = httptest.NewRequest(tc.method, tc.path, nil)
+		}
+		if tc.token {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for name, value := range tc.header {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d (body %s)", tc.name, rr.Code, tc.status, rr.Body.String())
+		}
+		spec.checkResponse(t, tc.method, documentedPath(tc.path), rr)
+	}
+
+	for _, withKeys := range []bool{true, false} {
+		openAIKey := ""
+		if withKeys {
+			openAIKey = "sk-test"
+		}
+		service := newContractTestService(t, openAIKey)
+		if withKeys {
+			service.config.AuthRoles = []string{"visitor", "operator"}
+		}
+		handler := service.routes()
+
+		login := httptest.NewRecorder()
+		loginReq := httptest.NewRequest("POST", "/auth", strings.NewReader(`{"username":"testuser","password":"testpass"}`))
+		loginReq.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(login, loginReq)
+		var auth AuthResponse
+		json.Unmarshal(login.Body.Bytes(), &auth)
+
+		var cases []contractCase
+		if withKeys {
+			cases = []contractCase{
+				{name: "health", method: "GET", path: "/health", status: 200},
+				{name: "openapi", method: "GET", path: "/openapi.json", status: 200},
+				{name: "login", method: "POST", path: "/auth", body: `{"username":"testuser","password":"testpass"}`, status: 200},
+				{name: "bad credentials", method: "POST", path: "/auth", body: `{"username":"testuser","password":"nope"}`, status: 401},
+				{name: "unknown field", method: "POST", path: "/auth", body: `{"username":"a","password":"b","admin":true}`, status: 400},
+				{name: "wrong content type", method: "POST", path: "/auth", body: `{}`, header: map[string]string{"Content-Type": "text/plain"}, status: 415},
+				{name: "body too large", method: "POST", path: "/auth", body: `{"username":"` + strings.Repeat("a", 2048) + `"}`, status: 413},
+				{name: "openai secret", method: "GET", path: "/api/v1/secrets/openai", token: true, status: 200},
+				{name: "no token", method: "GET", path: "/api/v1/secrets/openai", status: 401},
+				{name: "named secret", method: "GET", path: "/api/v1/secrets/firebase", token: true, status: 200},
+				{name: "forbidden secret", method: "GET", path: "/api/v1/secrets/database", token: true, status: 403},
+				{name: "secret metadata", method: "GET", path: "/api/v1/secrets", token: true, status: 200},
+				{name: "chat", method: "POST", path: "/api/v1/chat", body: `{"message":"Hi"}`, token: true, status: 200},
+				{name: "chat suggestions", method: "GET", path: "/api/v1/chat/suggestions?limit=20", token: true, status: 200},
+				{name: "chat suggestions bad limit", method: "GET", path: "/api/v1/chat/suggestions?limit=0", token: true, status: 400},
+				{name: "chat rate limited", method: "POST", path: "/api/v1/chat", body: `{"message":"Hi"}`, token: true, status: 429},
+				{name: "legacy alias", method: "GET", path: "/api/secrets/openai", token: true, status: 200},
+			}
+		} else {
+			cases = []contractCase{
+				{name: "chat disabled", method: "POST", path: "/api/v1/chat", body: `{"message":"Hi"}`, token: true, status: 500},
+				{name: "openai not configured", method: "GET", path: "/api/v1/secrets/openai", token: true, status: 500},
+				{name: "unset secret", method: "GET", path: "/api/v1/secrets/firebase", token: true, status: 500},
+				{name: "secret metadata without operator role", method: "GET", path: "/api/v1/secrets", token: true, status: 403},
+			}
+		}
+
+		for _, tc := range cases {
+			run(t, handler, auth.Token, tc)
+		}
+	}
+}
+
+// TestOpenAPIErrorCodes keeps the documented error code enum in sync with the Go constants
+func TestOpenAPIErrorCodes(t *testing.T) {
+	spec := loadSpec(t)
+	schema := spec.resolve(map[string]interface{}{"$ref": "#/components/schemas/ErrorResponse"})
+	code := schema["properties"].(map[string]interface{})["code"].(map[string]interface{})
+
+	var documented []string
+	for _, value := range code["enum"].([]interface{}) {
+		documented = append(documented, value.(string))
+	}
+	sort.Strings(documented)
+
+	source, err := os.ReadFile(filepath.Join("internal", "errors.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := regexp.MustCompile(`ErrorCode = "([a-z_]+)"`).FindAllStringSubmatch(string(source), -1)
+	var defined []string
+	for _, match := range matches {
+		defined = append(defined, match[1])
+	}
+	sort.Strings(defined)
+
+	if strings.Join(documented, ",") != strings.Join(defined, ",") {
+		t.Errorf("error codes drifted:\n openapi.json: %v\n errors.go:    %v", documented, defined)
+	}
+}
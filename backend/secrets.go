@@ -0,0 +1,437 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"portfolio-secrets-service/internal"
+)
+
+// CreateSecretRequest adds a secret to the writable store
+type CreateSecretRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// ExpiresAt optionally records when the value should be rotated by
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateSecretRequest stores a new value. ExpectedVersion is the version the
+// caller last read; the write fails with 409 if the secret changed since.
+type UpdateSecretRequest struct {
+	Value           string     `json:"value"`
+	ExpectedVersion *int       `json:"expected_version"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// RotateSecretRequest stores a new value, generating a random one if Value is empty
+type RotateSecretRequest struct {
+	Value           string     `json:"value,omitempty"`
+	ExpectedVersion *int       `json:"expected_version"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// RollbackSecretRequest restores a retained earlier version as a new version
+type RollbackSecretRequest struct {
+	Version         int  `json:"version"`
+	ExpectedVersion *int `json:"expected_version"`
+}
+
+// SecretMetadata describes a secret without its value
+type SecretMetadata struct {
+	Name        string                   `json:"name"`
+	Backend     string                   `json:"backend"`
+	Version     int                      `json:"version"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+	Fingerprint string                   `json:"fingerprint"`
+	ExpiresAt   *time.Time               `json:"expires_at,omitempty"`
+	Versions    []internal.SecretVersion `json:"versions,omitempty"`
+	// Value is only returned once, when rotate generated it
+	Value string `json:"value,omitempty"`
+}
+
+// SecretInfo is the public metadata of a configured secret
+type SecretInfo struct {
+	Name        string     `json:"name"`
+	Backend     string     `json:"backend"`
+	Version     int        `json:"version"`
+	LastRotated time.Time  `json:"last_rotated"`
+	Fingerprint string     `json:"fingerprint"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// SecretListResponse lists every configured secret without values
+type SecretListResponse struct {
+	Secrets []SecretInfo `json:"secrets"`
+}
+
+func secretInfo(secret internal.Secret) SecretInfo {
+	info := SecretInfo{
+		Name:        secret.Name,
+		Backend:     secret.Backend,
+		Version:     secret.Version,
+		LastRotated: secret.UpdatedAt,
+		Fingerprint: internal.SecretFingerprint(secret.Value),
+	}
+	if !secret.ExpiresAt.IsZero() {
+		info.ExpiresAt = &secret.ExpiresAt
+	}
+	return info
+}
+
+func secretMetadata(secret internal.Secret) SecretMetadata {
+	info := secretInfo(secret)
+	return SecretMetadata{Name: info.Name, Backend: info.Backend, Version: info.Version, UpdatedAt: info.LastRotated, Fingerprint: info.Fingerprint, ExpiresAt: info.ExpiresAt}
+}
+
+// SecretReloadResponse lists the secrets whose values changed
+type SecretReloadResponse struct {
+	Changed []string `json:"changed"`
+}
+
+// newSecretStores returns the writable file store (if configured) ahead of
+// the environment values, so admin writes shadow env secrets. The env store
+// reloads from .env and the config file at configPath when they change.
+func newSecretStores(config *Config, configPath string) (internal.SecretStores, error) {
+	var stores internal.SecretStores
+	if config.Secrets.File != "" {
+		fileStore, err := internal.NewFileSecretStore(config.Secrets.File, config.Secrets.KeepVersions)
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, fileStore)
+	}
+
+	envStore := internal.NewEnvSecretStore(envSecrets(config))
+	envStore.Files = []string{".env"}
+	if path := resolveConfigPath(configPath); path != "" {
+		envStore.Files = append(envStore.Files, path)
+	}
+	envStore.Source = func() (map[string]string, error) {
+		lookup, err := reloadedEnv()
+		if err != nil {
+			return nil, err
+		}
+		config, err := readConfig(configPath, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return envSecrets(config), nil
+	}
+	return append(stores, envStore), nil
+}
+
+func envSecrets(config *Config) map[string]string {
+	return map[string]string{
+		"openai":   config.OpenAIKey,
+		"firebase": config.FirebaseKey,
+	}
+}
+
+// watchSecrets reloads the secret stores every interval and on each value
+// sent to hangup (SIGHUP). Lookups keep serving the previous values while a
+// reload runs and when it fails, so no request sees a missing key.
+func (s *SecretService) watchSecrets(interval time.Duration, hangup <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hangup:
+			log.Printf("SIGHUP received, reloading secrets")
+			s.reloadSecrets("signal")
+		case <-ticker.C:
+			s.reloadSecrets("poll")
+		}
+	}
+}
+
+func (s *SecretService) reloadSecrets(trigger string) ([]string, error) {
+	changed, err := s.secrets.Reload()
+	result := "success"
+	if err != nil {
+		result = "error"
+		log.Printf("Secret reload (%s) failed, keeping previous values: %v", trigger, err)
+	}
+	s.metrics.Inc("secret_reloads_total", "Secret store reloads by trigger and result.", "trigger", trigger, "result", result)
+	for _, name := range changed {
+		log.Printf("Secret %s changed on reload (%s)", name, trigger)
+		s.metrics.Inc("secret_changes_total", "Secret values picked up by a reload.", "secret", name)
+	}
+	return changed, err
+}
+
+func (s *SecretService) reloadSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	changed, err := s.reloadSecrets("admin")
+	if err != nil {
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Secret reload failed: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SecretReloadResponse{Changed: append([]string{}, changed...)})
+}
+
+// registerSecretAdminRoutes adds secret management to the admin router
+func (s *SecretService) registerSecretAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/secrets", s.createSecretHandler).Methods("POST")
+	router.HandleFunc("/admin/secrets/reload", s.reloadSecretsHandler).Methods("POST")
+	router.HandleFunc("/admin/secrets/{secretName}", s.secretMetadataHandler).Methods("GET")
+	router.HandleFunc("/admin/secrets/{secretName}", s.updateSecretHandler).Methods("PUT")
+	router.HandleFunc("/admin/secrets/{secretName}", s.deleteSecretHandler).Methods("DELETE")
+	router.HandleFunc("/admin/secrets/{secretName}/rotate", s.rotateSecretHandler).Methods("POST")
+	router.HandleFunc("/admin/secrets/{secretName}/rollback", s.rollbackSecretHandler).Methods("POST")
+}
+
+func (s *SecretService) secretMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["secretName"]
+	secret, err := s.secrets.Get(name)
+	if err != nil {
+		s.writeSecretStoreError(w, r, err)
+		return
+	}
+	metadata := secretMetadata(secret)
+	if store := s.secrets.Writable(); store != nil && store.Backend() == secret.Backend {
+		metadata.Versions, _ = store.Versions(name)
+	}
+	writeSecretMetadata(w, http.StatusOK, metadata)
+}
+
+func (s *SecretService) createSecretHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateSecretRequest
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
+		internal.WriteDecodeError(w, r, err)
+		return
+	}
+	if req.Name == "" || req.Value == "" {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "name and value are required")
+		return
+	}
+	s.writeSecret(w, r, internal.AuditSecretCreate, req.Name, func(store internal.WritableSecretStore) (internal.Secret, error) {
+		return store.PutExpiring(req.Name, req.Value, optionalTime(req.ExpiresAt), 0)
+	}, "")
+}
+
+func (s *SecretService) updateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["secretName"]
+	var req UpdateSecretRequest
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
+		internal.WriteDecodeError(w, r, err)
+		return
+	}
+	if req.Value == "" || req.ExpectedVersion == nil {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "value and expected_version are required")
+		return
+	}
+	s.writeSecret(w, r, internal.AuditSecretUpdate, name, func(store internal.WritableSecretStore) (internal.Secret, error) {
+		return store.PutExpiring(name, req.Value, optionalTime(req.ExpiresAt), s.writeVersion(store, name, *req.ExpectedVersion))
+	}, "")
+}
+
+func (s *SecretService) rotateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["secretName"]
+	var req RotateSecretRequest
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
+		internal.WriteDecodeError(w, r, err)
+		return
+	}
+	if req.ExpectedVersion == nil {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "expected_version is required")
+		return
+	}
+
+	value, generated := req.Value, ""
+	if value == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			log.Printf("Failed to generate a value for secret %s: %v", name, err)
+			s.audit(r, internal.AuditEvent{Action: internal.AuditSecretRotate, Outcome: internal.AuditError, Subject: adminSubject(r), Secret: name, Reason: err.Error()})
+			internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to generate a secret value")
+			return
+		}
+		value = base64.RawURLEncoding.EncodeToString(buf)
+		generated = value
+	}
+	s.writeSecret(w, r, internal.AuditSecretRotate, name, func(store internal.WritableSecretStore) (internal.Secret, error) {
+		return store.PutExpiring(name, value, optionalTime(req.ExpiresAt), s.writeVersion(store, name, *req.ExpectedVersion))
+	}, generated)
+}
+
+func (s *SecretService) rollbackSecretHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["secretName"]
+	var req RollbackSecretRequest
+	if err := internal.DecodeJSON(r, &req, true); err != nil {
+		internal.WriteDecodeError(w, r, err)
+		return
+	}
+	if req.Version < 1 || req.ExpectedVersion == nil {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "version and expected_version are required")
+		return
+	}
+	s.writeSecret(w, r, internal.AuditSecretRollback, name, func(store internal.WritableSecretStore) (internal.Secret, error) {
+		return store.Rollback(name, req.Version, *req.ExpectedVersion)
+	}, "")
+}
+
+func (s *SecretService) deleteSecretHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["secretName"]
+	expected, err := strconv.Atoi(r.URL.Query().Get("expected_version"))
+	if err != nil {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "expected_version query parameter is required")
+		return
+	}
+	store := s.secrets.Writable()
+	if store == nil {
+		internal.WriteError(w, r, http.StatusConflict, internal.CodeSecretsReadOnly, "No writable secret store is configured")
+		return
+	}
+
+	event := internal.AuditEvent{Action: internal.AuditSecretDelete, Subject: adminSubject(r), Secret: name, Version: expected}
+	if err := store.Delete(name, expected); err != nil {
+		s.auditSecretFailure(r, event, err)
+		s.writeSecretStoreError(w, r, err)
+		return
+	}
+	event.Outcome = internal.AuditSuccess
+	s.audit(r, event)
+	log.Printf("Admin deleted secret %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeVersion is the version store expects for a write by a caller who saw
+// expected. A secret not yet in store shows the version of the store serving
+// it, e.g. the environment; writing against that version creates it.
+func (s *SecretService) writeVersion(store internal.WritableSecretStore, name string, expected int) int {
+	if _, err := store.Get(name); !errors.Is(err, internal.ErrSecretNotFound) {
+		return expected
+	}
+	if current, err := s.secrets.Get(name); err == nil && current.Backend != store.Backend() && current.Version == expected {
+		return 0
+	}
+	return expected
+}
+
+// writeSecret applies a change to the writable store, audits the outcome and
+// responds with the new metadata
+func (s *SecretService) writeSecret(w http.ResponseWriter, r *http.Request, action, name string, change func(internal.WritableSecretStore) (internal.Secret, error), generatedValue string) {
+	if !internal.ValidSecretName(name) {
+		internal.WriteError(w, r, http.StatusBadRequest, internal.CodeInvalidRequest, "Secret names use lowercase letters, digits, '.', '_' and '-' (up to 64)")
+		return
+	}
+	store := s.secrets.Writable()
+	if store == nil {
+		internal.WriteError(w, r, http.StatusConflict, internal.CodeSecretsReadOnly, "No writable secret store is configured")
+		return
+	}
+
+	event := internal.AuditEvent{Action: action, Subject: adminSubject(r), Secret: name}
+	secret, err := change(store)
+	if err != nil {
+		s.auditSecretFailure(r, event, err)
+		s.writeSecretStoreError(w, r, err)
+		return
+	}
+	event.Outcome, event.Version = internal.AuditSuccess, secret.Version
+	s.audit(r, event)
+	log.Printf("Admin %s of secret %s, now version %d", action, name, secret.Version)
+
+	status := http.StatusOK
+	if action == internal.AuditSecretCreate {
+		status = http.StatusCreated
+	}
+	metadata := secretMetadata(secret)
+	metadata.Value = generatedValue
+	metadata.Versions, _ = store.Versions(name)
+	writeSecretMetadata(w, status, metadata)
+}
+
+func (s *SecretService) auditSecretFailure(r *http.Request, event internal.AuditEvent, err error) {
+	event.Outcome, event.Reason = internal.AuditFailure, err.Error()
+	if !errors.Is(err, internal.ErrVersionConflict) && !errors.Is(err, internal.ErrSecretNotFound) {
+		event.Outcome = internal.AuditError
+	}
+	s.audit(r, event)
+}
+
+func (s *SecretService) writeSecretStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, internal.ErrVersionConflict):
+		internal.WriteError(w, r, http.StatusConflict, internal.CodeVersionConflict, "Secret changed since it was read: "+err.Error())
+	case errors.Is(err, internal.ErrSecretNotFound):
+		internal.WriteError(w, r, http.StatusNotFound, internal.CodeNotFound, "Secret not found")
+	default:
+		log.Printf("Secret store error: %v", err)
+		internal.WriteError(w, r, http.StatusInternalServerError, internal.CodeInternal, "Failed to update secret")
+	}
+}
+
+// listSecretsHandler serves metadata of every configured secret to callers
+// holding one of the secrets.metadata_roles
+func (s *SecretService) listSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(claimsContextKey).(*Claims)
+	if claims == nil || !hasAnyRole(claims.Roles, s.config.Secrets.MetadataRoles) {
+		s.audit(r, internal.AuditEvent{Action: internal.AuditSecretList, Outcome: internal.AuditDenied, Reason: "missing a metadata role"})
+		internal.WriteError(w, r, http.StatusForbidden, internal.CodeSecretNotAllowed, "Listing secrets requires an operator role")
+		return
+	}
+
+	response := SecretListResponse{Secrets: []SecretInfo{}}
+	for _, name := range s.secrets.Names() {
+		secret, err := s.secrets.Get(name)
+		if err != nil {
+			continue
+		}
+		response.Secrets = append(response.Secrets, secretInfo(secret))
+	}
+	s.audit(r, internal.AuditEvent{Action: internal.AuditSecretList, Outcome: internal.AuditSuccess})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// logSecretInventory prints the metadata of each configured secret at startup
+func logSecretInventory(stores internal.SecretStores) {
+	for _, name := range stores.Names() {
+		secret, err := stores.Get(name)
+		if err != nil {
+			continue
+		}
+		expiry := "no expiry"
+		if !secret.ExpiresAt.IsZero() {
+			expiry = "expires " + secret.ExpiresAt.Format(time.RFC3339)
+			if secret.ExpiresAt.Before(time.Now()) {
+				expiry = "EXPIRED " + secret.ExpiresAt.Format(time.RFC3339)
+			}
+		}
+		log.Printf("  Secret %s: %s backend, version %d, %s, %s", name, secret.Backend, secret.Version, internal.SecretFingerprint(secret.Value)[:19], expiry)
+	}
+}
+
+func hasAnyRole(roles, allowed []string) bool {
+	for _, role := range roles {
+		for _, want := range allowed {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func optionalTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func writeSecretMetadata(w http.ResponseWriter, status int, metadata SecretMetadata) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(metadata)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"portfolio-secrets-service/internal"
+)
+
+// errCSRF is returned when a cookie session's unsafe request lacks a matching CSRF token
+var errCSRF = errors.New("CSRF token missing or invalid")
+
+// startSession hands a newly issued token to the client. With cookie sessions
+// the token only travels in the HttpOnly cookie and the response carries the
+// CSRF token the frontend must echo.
+func (s *SecretService) startSession(w http.ResponseWriter, claims *Claims, tokenString string) AuthResponse {
+	if !s.config.Session.Cookies {
+		return AuthResponse{Token: tokenString}
+	}
+	csrf := s.csrfToken(claims.ID)
+	maxAge := int(tokenLifetime.Seconds())
+	http.SetCookie(w, s.sessionCookie(s.config.Session.CookieName, tokenString, maxAge, true))
+	http.SetCookie(w, s.sessionCookie(s.config.Session.CSRFCookieName, csrf, maxAge, false))
+	return AuthResponse{CSRFToken: csrf}
+}
+
+// endSession clears both cookies
+func (s *SecretService) endSession(w http.ResponseWriter) {
+	http.SetCookie(w, s.sessionCookie(s.config.Session.CookieName, "", -1, true))
+	http.SetCookie(w, s.sessionCookie(s.config.Session.CSRFCookieName, "", -1, false))
+}
+
+// sessionCookie scopes a cookie by the session config. The CSRF cookie is not
+// HttpOnly so the frontend can read it back after a reload.
+func (s *SecretService) sessionCookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   s.config.Session.Domain,
+		Path:     s.config.Session.Path,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   s.config.Session.Secure,
+		SameSite: s.config.Session.sameSite(),
+	}
+}
+
+// csrfToken binds the CSRF token to the session's token ID, so a cookie
+// planted by a sibling subdomain cannot be paired with a made-up header
+func (s *SecretService) csrfToken(tokenID string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.JWTSecret))
+	mac.Write([]byte("csrf:" + tokenID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sessionTokenFromRequest returns the bearer token, or the session cookie
+// when there is no Authorization header and cookie sessions are on
+func (s *SecretService) sessionTokenFromRequest(r *http.Request) (token string, fromCookie bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		return strings.TrimPrefix(header, "Bearer "), false
+	}
+	if !s.config.Session.Cookies {
+		return "", false
+	}
+	cookie, err := r.Cookie(s.config.Session.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// checkCSRF applies the double-submit check to state-changing requests: the
+// header must match the CSRF cookie and the session it was issued for
+func (s *SecretService) checkCSRF(r *http.Request, claims *Claims) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	header := r.Header.Get(s.config.Session.CSRFHeader)
+	cookie, err := r.Cookie(s.config.Session.CSRFCookieName)
+	if header == "" || err != nil {
+		return errCSRF
+	}
+	expected := s.csrfToken(claims.ID)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(header), []byte(expected)) != 1 {
+		return errCSRF
+	}
+	return nil
+}
+
+// logoutHandler revokes the presented session token and clears the cookies
+func (s *SecretService) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	tokenString, fromCookie := s.sessionTokenFromRequest(r)
+	if claims, err := s.sessionClaims(tokenString); err == nil {
+		if fromCookie {
+			if err := s.checkCSRF(r, claims); err != nil {
+				log.Printf("Logout rejected for %s: %v", claims.Username, err)
+				internal.WriteError(w, r, http.StatusForbidden, internal.CodeCSRFFailed, "CSRF token missing or invalid")
+				return
+			}
+		}
+		expiresAt := time.Now().Add(tokenLifetime)
+		if claims.ExpiresAt != nil {
+			expiresAt = claims.ExpiresAt.Time
+		}
+		s.revocations.Revoke(claims.ID, expiresAt)
+		log.Printf("Logout for %s revoked token %s", claims.Username, claims.ID)
+	}
+	if s.config.Session.Cookies {
+		s.endSession(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c SessionConfig) sameSite() http.SameSite {
+	switch c.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCookieSessions(t *testing.T) {
+	spec := loadSpec(t)
+	service := newContractTestService(t, "sk-test")
+	service.config.Session.Cookies = true
+	service.config.Session.SameSite = "strict"
+	handler := service.routes()
+
+	req := httptest.NewRequest("POST", "/auth", strings.NewReader(`{"username":"testuser","password":"testpass"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login: status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	spec.checkResponse(t, "POST", "/auth", rr)
+
+	var auth AuthResponse
+	json.Unmarshal(rr.Body.Bytes(), &auth)
+	if auth.Token != "" || auth.CSRFToken == "" {
+		t.Fatalf("login body = %s, want only a csrf_token", rr.Body.String())
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session, csrf := cookies["session"], cookies["csrf_token"]
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode || session.Path != "/" {
+		t.Fatalf("session cookie = %+v", session)
+	}
+	if csrf == nil || csrf.HttpOnly || csrf.Value != auth.CSRFToken {
+		t.Fatalf("csrf cookie = %+v", csrf)
+	}
+
+	send := func(method, path, csrfHeader string, withCookies bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		if withCookies {
+			req.AddCookie(&http.Cookie{Name: session.Name, Value: session.Value})
+			req.AddCookie(&http.Cookie{Name: csrf.Name, Value: csrf.Value})
+		}
+		if csrfHeader != "" {
+			req.Header.Set("X-CSRF-Token", csrfHeader)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("GET", "/api/v1/secrets/openai", "", true); rr.Code != http.StatusOK {
+		t.Errorf("read with cookie: status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	for name, header := range map[string]string{"missing": "", "forged": "forged-token"} {
+		rr := send("POST", "/api/v1/chat", header, true)
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"csrf_failed"`) {
+			t.Errorf("chat with %s CSRF header: status = %d, body %s", name, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := send("POST", "/auth/logout", "", true); rr.Code != http.StatusForbidden {
+		t.Errorf("logout without CSRF header: status = %d, want 403", rr.Code)
+	}
+
+	rr = send("POST", "/auth/logout", auth.CSRFToken, true)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("logout: status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Errorf("logout left cookie %s set", cookie.Name)
+		}
+	}
+	if rr := send("GET", "/api/v1/secrets/openai", "", true); rr.Code != http.StatusUnauthorized {
+		t.Errorf("read after logout: status = %d, want 401", rr.Code)
+	}
+	if rr := send("GET", "/api/v1/secrets/openai", "", false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("read without cookie: status = %d, want 401", rr.Code)
+	}
+}
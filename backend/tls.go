@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"portfolio-secrets-service/internal"
+)
+
+// serve runs the public API listener, the admin listener and, when TLS is
+// enabled, the HTTP->HTTPS redirect listener until one of them fails
+func serve(config *Config, handler, adminHandler http.Handler) error {
+	server := &http.Server{Addr: ":" + config.Port, Handler: handler}
+	adminServer := &http.Server{Addr: config.Admin.Addr, Handler: adminHandler}
+	errs := make(chan error, 3)
+
+	if !config.TLS.Enabled {
+		if config.Admin.Enabled() {
+			go func() {
+				log.Printf("Admin listener starting at http://%s", config.Admin.Addr)
+				errs <- adminServer.ListenAndServe()
+			}()
+		}
+		go func() {
+			log.Printf("Server starting on port %s, listening at http://localhost:%s", config.Port, config.Port)
+			errs <- server.ListenAndServe()
+		}()
+		return <-errs
+	}
+
+	tlsConfig, err := config.TLS.serverConfig()
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = tlsConfig
+	adminServer.TLSConfig = tlsConfig
+
+	if config.Admin.Enabled() {
+		go func() {
+			log.Printf("Admin listener starting at https://%s", config.Admin.Addr)
+			errs <- adminServer.ListenAndServeTLS("", "")
+		}()
+	}
+	if config.TLS.RedirectPort != "" {
+		go func() {
+			log.Printf("Redirecting http://localhost:%s to HTTPS", config.TLS.RedirectPort)
+			errs <- http.ListenAndServe(":"+config.TLS.RedirectPort, internal.RedirectToHTTPS(config.Port))
+		}()
+	}
+	go func() {
+		log.Printf("Server starting on port %s, listening at https://localhost:%s", config.Port, config.Port)
+		errs <- server.ListenAndServeTLS("", "")
+	}()
+	return <-errs
+}
+
+// serverConfig builds the tls.Config: a hot-reloaded certificate, the
+// configured version floor and ciphers, and optional client verification
+func (t TLSConfig) serverConfig() (*tls.Config, error) {
+	reloader, err := internal.NewCertReloader(t.CertFile, t.KeyFile, time.Duration(t.ReloadIntervalSeconds)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	minVersion, err := internal.ParseTLSVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := internal.ParseCipherSuites(t.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+	}
+	if t.ClientCAFile != "" {
+		clientCAs, err := internal.LoadClientCAs(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading tls.client_ca_file: %w", err)
+		}
+		// Certificates are optional at the handshake so the public listener
+		// keeps working; the admin listener enforces them with RequireClientCert
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// mutualTLS reports whether the admin listener requires a client certificate
+func (t TLSConfig) mutualTLS() bool {
+	return t.Enabled && t.ClientCAFile != ""
+}
+
+func (t TLSConfig) validate(port string) []error {
+	if !t.Enabled {
+		return nil
+	}
+
+	var errs []error
+	if t.CertFile == "" || t.KeyFile == "" {
+		errs = append(errs, errors.New("tls.cert_file and tls.key_file are required when tls.enabled is set"))
+	}
+	if t.ReloadIntervalSeconds < 1 {
+		errs = append(errs, errors.New("tls.reload_interval_seconds must be at least 1"))
+	}
+	if _, err := internal.ParseTLSVersion(t.MinVersion); err != nil {
+		errs = append(errs, fmt.Errorf("tls.min_version: %w", err))
+	}
+	if _, err := internal.ParseCipherSuites(t.CipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("tls.cipher_suites: %w", err))
+	}
+	if t.RedirectPort != "" {
+		if redirectPort, err := strconv.Atoi(t.RedirectPort); err != nil || redirectPort < 1 || redirectPort > 65535 {
+			errs = append(errs, fmt.Errorf("tls.redirect_port must be a number between 1 and 65535, got %q", t.RedirectPort))
+		} else if t.RedirectPort == port {
+			errs = append(errs, errors.New("tls.redirect_port must differ from port"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issueCert creates a certificate signed by parent (self-signed when parent is nil)
+func issueCert(t *testing.T, commonName string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{commonName},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestAdminListenerRequiresClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ca, caKey, caPEM, _ := issueCert(t, "Admin CA", true, nil, nil)
+	_, _, serverCert, serverKey := issueCert(t, "localhost", false, nil, nil)
+	_, _, clientCert, clientKey := issueCert(t, "operator", false, ca, caKey)
+
+	service := newContractTestService(t, "sk-test")
+	service.config.Admin.Token = "admin-test-token"
+	service.config.TLS = TLSConfig{
+		Enabled:               true,
+		CertFile:              write("server.pem", serverCert),
+		KeyFile:               write("server-key.pem", serverKey),
+		ReloadIntervalSeconds: 60,
+		MinVersion:            "1.2",
+		ClientCAFile:          write("ca.pem", caPEM),
+	}
+	if errs := service.config.TLS.validate(service.config.Port); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	tlsConfig, err := service.config.TLS.serverConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startTLS := func(handler http.Handler) *httptest.Server {
+		server := httptest.NewUnstartedServer(handler)
+		server.TLS = tlsConfig
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	server := startTLS(service.routes())
+	adminServer := startTLS(service.adminRoutes())
+
+	clientPair, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, // the server certificate is self-signed
+			Certificates:       certs,
+		}}}
+	}
+
+	loginResp, err := newClient().Post(server.URL+"/auth", "application/json", strings.NewReader(`{"username":"testuser","password":"testpass"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var auth AuthResponse
+	json.NewDecoder(loginResp.Body).Decode(&auth)
+	loginResp.Body.Close()
+	if auth.Token == "" {
+		t.Fatalf("login without a client certificate should work, got status %d", loginResp.StatusCode)
+	}
+
+	get := func(client *http.Client, url, token string) int {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get(newClient(), adminServer.URL+"/admin/usage", "admin-test-token"); status != http.StatusForbidden {
+		t.Errorf("admin listener without client certificate: status = %d, want 403", status)
+	}
+	if status := get(newClient(), adminServer.URL+"/admin/usage", "wrong-token"); status != http.StatusForbidden {
+		t.Errorf("client certificate should be checked before the token: status = %d, want 403", status)
+	}
+	if status := get(newClient(clientPair), adminServer.URL+"/admin/usage", "admin-test-token"); status != http.StatusOK {
+		t.Errorf("admin listener with client certificate: status = %d, want 200", status)
+	}
+	if status := get(newClient(), server.URL+"/api/v1/secrets/openai", auth.Token); status != http.StatusOK {
+		t.Errorf("public route without client certificate: status = %d, want 200", status)
+	}
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	config := defaultConfig()
+	config.TLS.Enabled = true
+	config.TLS.MinVersion = "1.1"
+	config.TLS.CipherSuites = []string{"TLS_FAKE"}
+	config.TLS.RedirectPort = config.Port
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected TLS validation errors")
+	}
+	for _, want := range []string{"tls.cert_file", "tls.min_version", "tls.cipher_suites", "tls.redirect_port"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %s in validation error, got %v", want, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 import React, {useEffect, useRef, useState, useCallback, useMemo} from "react";
 import ChatMessage, {ChatMessageProps} from "../ChatMessage/ChatMessage";
 import {secretsService} from "../../services/secretsService";
+import {ApiErrorResponse} from "../../types/ApiError";
 
 interface AboutMeSectionProps {
 	width?: number;
@@ -34,6 +35,8 @@ const AboutMeSection: React.FC<AboutMeSectionProps> = () => {
 	const [input, setInput] = useState("");
 	const [completed, setCompleted] = useState(true);
 	const chatContainerRef = useRef<HTMLDivElement>(null);
+	// Sent with every message so the backend keeps one prompt template per visit
+	const conversationIdRef = useRef<string | undefined>(undefined);
 
 	// 1. Secrets service initialization - runs ONLY once on mount
 	useEffect(() => {
@@ -78,13 +81,13 @@ const AboutMeSection: React.FC<AboutMeSectionProps> = () => {
 		async (message: string): Promise<string> => {
 			try {
 				const sendChatRequest = async (token: string | null): Promise<Response> =>
-					fetch(import.meta.env.VITE_SECRETS_SERVICE_URL + "/api/chat", {
+					fetch(import.meta.env.VITE_SECRETS_SERVICE_URL + "/api/v1/chat", {
 						method: "POST",
 						headers: {
 							"Content-Type": "application/json",
 							...(token ? {Authorization: `Bearer ${token}`} : {}),
 						},
-						body: JSON.stringify({message}),
+						body: JSON.stringify({message, conversation_id: conversationIdRef.current}),
 					});
 
 				let token = await secretsService.getValidToken(authCredentials);
@@ -99,7 +102,7 @@ const AboutMeSection: React.FC<AboutMeSectionProps> = () => {
 				if (!response.ok) {
 					let backendError = `Backend chat API error: ${response.status}`;
 					try {
-						const errorData = await response.json();
+						const errorData: Partial<ApiErrorResponse> = await response.json();
 						if (errorData?.error && typeof errorData.error === "string") {
 							backendError = errorData.error;
 						}
@@ -111,10 +114,11 @@ const AboutMeSection: React.FC<AboutMeSectionProps> = () => {
 				}
 
 				const data = await response.json();
+				if (data.conversation_id) {
+					conversationIdRef.current = data.conversation_id;
+				}
 				if (data.response) {
 					return data.response;
-				} else if (data.error) {
-					throw new Error(data.error);
 				} else {
 					return "Sorry, I couldn't process that request.";
 				}
@@ -0,0 +1,36 @@
+/** Stable error codes returned by the secrets service. */
+export type ApiErrorCode =
+    | "invalid_request"
+    | "body_too_large"
+    | "unsupported_media_type"
+    | "not_found"
+    | "method_not_allowed"
+    | "invalid_credentials"
+    | "auth_required"
+    | "invalid_token"
+    | "client_cert_required"
+    | "account_not_allowed"
+    | "csrf_failed"
+    | "secret_not_allowed"
+    | "secret_not_configured"
+    | "version_conflict"
+    | "secrets_read_only"
+    | "rate_limited"
+    | "quota_exceeded"
+    | "chat_disabled"
+    | "message_too_long"
+    | "message_rejected"
+    | "upstream_rate_limited"
+    | "upstream_unavailable"
+    | "upstream_error"
+    | "internal_error";
+
+/** Error body returned by every secrets service endpoint. */
+export interface ApiErrorResponse {
+    error: string;
+    code: ApiErrorCode;
+    status: number;
+    request_id?: string;
+    retryable: boolean;
+    retry_after?: number;
+}